@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// per user cache directory, a shared one would let other users plant responses
+func defaultCacheDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "check_graylog2")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("check_graylog2-%d", os.Getuid()))
+}
+
+// whether -cache-dir is a directory only this user can write to
+func cacheSafe() bool {
+	info, err := os.Lstat(*cacheDir)
+	if err != nil || !info.IsDir() || !privateDir(info) {
+		if len(debug) != 0 {
+			fmt.Println("unsafe cache directory", *cacheDir)
+		}
+		return false
+	}
+	return true
+}
+
+// cache file of an endpoint, the credentials are part of the key so
+// users never see responses fetched with other permissions
+func cacheFile(target, user, pass string) string {
+	sum := sha256.Sum256([]byte(user + "\x00" + pass + "\x00" + target))
+	return filepath.Join(*cacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// response body of an endpoint fetched within -cache-ttl
+func cached(target, user, pass string) ([]byte, bool) {
+	if *cacheTTL <= 0 || !cacheSafe() {
+		return nil, false
+	}
+
+	file := cacheFile(target, user, pass)
+	info, err := os.Stat(file)
+	if err != nil || time.Since(info.ModTime()) > *cacheTTL {
+		return nil, false
+	}
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+
+	if len(debug) != 0 {
+		fmt.Println("cached", target)
+	}
+	return body, true
+}
+
+// keep a successful response body for the following runs
+func store(target, user, pass string, body []byte) {
+	if *cacheTTL <= 0 {
+		return
+	}
+
+	if err := os.MkdirAll(*cacheDir, 0700); err != nil || !cacheSafe() {
+		return
+	}
+	file := cacheFile(target, user, pass)
+	// a failing cache must not fail the check
+	writeAtomic(filepath.Dir(file), filepath.Base(file), body, 0600)
+}
+
+// replace a file atomically via a temporary file in the same directory
+func writeAtomic(dir, name string, data []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// cache in a private temporary directory
+func cacheFixture(t *testing.T, ttl string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "cache")
+	setFlag(t, "cache-dir", dir)
+	setFlag(t, "cache-ttl", ttl)
+	return dir
+}
+
+func TestCacheDisabled(t *testing.T) {
+	dir := cacheFixture(t, "0s")
+	store("http://graylog:9000/api/system", "u", "p", []byte(`{}`))
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cache directory created without -cache-ttl: %v", err)
+	}
+	if _, ok := cached("http://graylog:9000/api/system", "u", "p"); ok {
+		t.Error("hit without -cache-ttl")
+	}
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	cacheFixture(t, "1m")
+	target := "http://graylog:9000/api/system"
+
+	if _, ok := cached(target, "u", "p"); ok {
+		t.Fatal("hit before anything was stored")
+	}
+
+	store(target, "u", "p", []byte(`{"is_processing":true}`))
+	body, ok := cached(target, "u", "p")
+	if !ok || string(body) != `{"is_processing":true}` {
+		t.Fatalf("got %q %v, want the stored body", body, ok)
+	}
+
+	if _, ok := cached(target, "other", "p"); ok {
+		t.Error("hit with other credentials")
+	}
+	if _, ok := cached(target+"/other", "u", "p"); ok {
+		t.Error("hit for another endpoint")
+	}
+}
+
+func TestCacheExpired(t *testing.T) {
+	cacheFixture(t, "30s")
+	target := "http://graylog:9000/api/system"
+
+	store(target, "u", "p", []byte(`{}`))
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(cacheFile(target, "u", "p"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cached(target, "u", "p"); ok {
+		t.Error("hit for a response older than -cache-ttl")
+	}
+}
+
+func TestCacheUnsafeDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory modes are not enforced on windows")
+	}
+	dir := cacheFixture(t, "1m")
+	target := "http://graylog:9000/api/system"
+
+	// planted by another user of a shared directory
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cacheFile(target, "u", "p"), []byte(`{"is_processing":true}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cached(target, "u", "p"); ok {
+		t.Error("hit in a world writable cache directory")
+	}
+	store(target, "u", "p", []byte(`{}`))
+	if body, _ := os.ReadFile(cacheFile(target, "u", "p")); string(body) != `{"is_processing":true}` {
+		t.Error("stored into a world writable cache directory")
+	}
+}
@@ -0,0 +1,495 @@
+// ncg2-mockserver serves canned Graylog API responses for all endpoints used
+// by check_graylog2, with toggles to simulate failures.
+//
+// Toggles are flags and can be changed at runtime:
+//
+//	curl 'http://localhost:12900/_mock/set?journal-full=true&collectors-offline=2'
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// server
+	listen  *string
+	major   *int
+	user    *string
+	pass    *string
+	record  *string
+	delay   *time.Duration
+	failure *int
+	// node state
+	notProcessing *bool
+	lifecycle     *string
+	lbStatus      *string
+	journalFull   *bool
+	nodes         *int
+	nodesDown     *int
+	leaders       *int
+	// messages
+	throughput    *int
+	events        *int
+	inputs        *int
+	indexFailures *int
+	// collectors, forwarders and streams
+	collectors             *int
+	collectorsOffline      *int
+	collectorsFailing      *int
+	noCollectorPlugin      *bool
+	forwarders             *int
+	forwardersDisconnected *int
+	forwarderInputsFailing *int
+	streams                *int
+	streamThroughput       *int
+	streamAlerts           *int
+	streamExecutionTime    *time.Duration
+	streamsPaused          *int
+
+	// guards the toggles against /_mock/set
+	lock sync.RWMutex
+)
+
+// handle args
+func init() {
+	listen = flag.String("listen", ":12900", "Listen address")
+	major = flag.Int("graylog-version", 2, "Graylog major version to imitate: 2, 3, 4 or 5")
+	user = flag.String("u", "", "Require this API username")
+	pass = flag.String("p", "", "Require this API password")
+	record = flag.String("responses", "", "Directory of recorded responses, e.g. system_cluster_nodes.json for /system/cluster/nodes")
+	delay = flag.Duration("delay", 0, "Delay every response, e.g. 20s")
+	failure = flag.Int("fail", 0, "Reply to every request with this HTTP code, e.g. 500")
+
+	notProcessing = flag.Bool("not-processing", false, "Message processing is disabled")
+	lifecycle = flag.String("lifecycle", "running", "Node lifecycle")
+	lbStatus = flag.String("lb-status", "alive", "Load balancer status, e.g. throttled")
+	journalFull = flag.Bool("journal-full", false, "The journal is full and the node throttled")
+	nodes = flag.Int("nodes", 1, "Number of cluster nodes")
+	nodesDown = flag.Int("nodes-down", 0, "Number of cluster nodes not responding")
+	leaders = flag.Int("leaders", 1, "Number of nodes claiming to be leader")
+
+	throughput = flag.Int("throughput", 250, "Messages per second")
+	events = flag.Int("events", 768764376, "Total number of messages")
+	inputs = flag.Int("inputs", 3, "Number of inputs")
+	indexFailures = flag.Int("index-failures", 0, "Number of index failures")
+
+	collectors = flag.Int("collectors", 3, "Number of collectors")
+	collectorsOffline = flag.Int("collectors-offline", 0, "Number of inactive collectors")
+	collectorsFailing = flag.Int("collectors-failing", 0, "Number of failing collectors")
+	noCollectorPlugin = flag.Bool("no-collector-plugin", false, "The collector plugin is not installed")
+	forwarders = flag.Int("forwarders", 2, "Number of forwarders")
+	forwardersDisconnected = flag.Int("forwarders-disconnected", 0, "Number of disconnected forwarders")
+	forwarderInputsFailing = flag.Int("forwarder-inputs-failing", 0, "Number of forwarders with a failing input")
+	streams = flag.Int("streams", 3, "Number of streams, with ids 000000000000000000000001 and up")
+	streamThroughput = flag.Int("stream-throughput", 50, "Messages per second of every stream")
+	streamAlerts = flag.Int("stream-alerts", 0, "Triggered alert conditions of every stream")
+	streamExecutionTime = flag.Duration("stream-execution-time", 120*time.Microsecond, "95th percentile of stream rule matching")
+	streamsPaused = flag.Int("streams-paused", 0, "Number of streams paused by the fault counter")
+}
+
+func main() {
+	flag.Parse()
+
+	log.Printf("imitating Graylog %d API at %s%s/", *major, *listen, prefix())
+	log.Fatal(http.ListenAndServe(*listen, handler()))
+}
+
+// base path of the API, Graylog 3 moved it from :12900/ to :9000/api
+func prefix() string {
+	if *major < 3 {
+		return ""
+	}
+	return "/api"
+}
+
+// routes of the mock server
+func handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_mock/set", toggle)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		lock.RLock()
+		base, wait := prefix(), *delay
+		lock.RUnlock()
+
+		// sleep outside of the lock so toggles are not blocked
+		time.Sleep(wait)
+		if !strings.HasPrefix(r.URL.Path, base+"/") {
+			reply(w, http.StatusNotFound, apiError("HTTP 404 Not Found"))
+			return
+		}
+		serve(w, r, strings.TrimPrefix(r.URL.Path, base))
+	})
+	return mux
+}
+
+// change toggles at runtime
+func toggle(w http.ResponseWriter, r *http.Request) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	for name, values := range r.URL.Query() {
+		if err := flag.Set(name, values[len(values)-1]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("%s=%s", name, values[len(values)-1])
+	}
+}
+
+// answer an API request
+func serve(w http.ResponseWriter, r *http.Request, path string) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if len(*user) > 0 || len(*pass) > 0 {
+		if u, p, ok := r.BasicAuth(); !ok || u != *user || p != *pass {
+			reply(w, http.StatusUnauthorized, apiError("Not authorized"))
+			return
+		}
+	}
+	if *failure > 0 {
+		reply(w, *failure, apiError(http.StatusText(*failure)))
+		return
+	}
+
+	if len(*record) > 0 {
+		file := filepath.Join(*record, strings.Replace(strings.Trim(path, "/"), "/", "_", -1)+".json")
+		if body, err := ioutil.ReadFile(file); err == nil {
+			w.Write(body)
+			return
+		}
+	}
+
+	data, ok := canned(path)
+	if !ok {
+		reply(w, http.StatusNotFound, apiError("HTTP 404 Not Found"))
+		return
+	}
+	reply(w, http.StatusOK, data)
+}
+
+// write a JSON response
+func reply(w http.ResponseWriter, code int, data interface{}) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(data)
+}
+
+// Graylog error body
+func apiError(message string) map[string]interface{} {
+	return map[string]interface{}{"type": "ApiError", "message": message}
+}
+
+// canned response of an endpoint
+func canned(path string) (interface{}, bool) {
+	switch path {
+	case "/system":
+		return node(0), true
+	case "/system/indexer/failures":
+		return map[string]interface{}{"total": *indexFailures, "failures": []interface{}{}}, true
+	case "/system/throughput":
+		return map[string]interface{}{"throughput": *throughput}, true
+	case "/system/inputs":
+		return map[string]interface{}{"total": *inputs, "inputs": []interface{}{}}, true
+	case "/count/total":
+		return map[string]interface{}{"events": *events}, true
+	case "/system/notifications":
+		return notificationList(), true
+	case "/system/journal":
+		return journal(), true
+	case "/cluster":
+		return cluster(), true
+	case "/system/cluster/nodes":
+		return clusterNodes(), true
+	case "/plugins/org.graylog.plugins.collector/collectors":
+		// the legacy collector plugin was replaced by sidecars in Graylog 3
+		if *noCollectorPlugin || *major >= 3 {
+			return nil, false
+		}
+		return collectorList(), true
+	case "/plugins/org.graylog.plugins.forwarder/forwarder":
+		if *major < 4 {
+			return nil, false
+		}
+		return forwarderList(), true
+	case "/streams":
+		return streamList(), true
+	}
+
+	if ns := strings.TrimPrefix(path, "/system/metrics/namespace/"); ns != path {
+		return metricsNamespace(ns)
+	}
+
+	// /streams/<id>/throughput and /streams/<id>/alerts/check
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 3 && parts[0] == "streams" && knownStream(parts[1]) {
+		switch strings.Join(parts[2:], "/") {
+		case "throughput":
+			return map[string]interface{}{"throughput": *streamThroughput}, true
+		case "alerts/check":
+			// legacy alert conditions were removed in Graylog 4
+			if *major >= 4 {
+				return nil, false
+			}
+			return map[string]interface{}{"total_triggered": *streamAlerts, "results": []interface{}{}}, true
+		}
+	}
+
+	return nil, false
+}
+
+// version reported by /system
+func release() string {
+	switch *major {
+	case 2:
+		return "2.5.2+4e7d3d4"
+	case 3:
+		return "3.3.16+b5a6ba5"
+	case 5:
+		return "5.2.4+d8238aa"
+	}
+	return "4.3.15+b8a5d8d"
+}
+
+// id of the n-th node
+func nodeID(n int) string {
+	return fmt.Sprintf("7e0d5e5b-6c2b-4e1d-9f3a-%012d", n+1)
+}
+
+// /system of the n-th node
+func node(n int) map[string]interface{} {
+	// a full journal throttles the node like in Graylog
+	lb := *lbStatus
+	if *journalFull {
+		lb = "throttled"
+	}
+
+	return map[string]interface{}{
+		"facility":         "graylog-server",
+		"codename":         "Noir",
+		"node_id":          nodeID(n),
+		"cluster_id":       "3adaf799-1551-4239-84e5-6ed939b56f62",
+		"version":          release(),
+		"started_at":       time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+		"is_processing":    !*notProcessing,
+		"hostname":         fmt.Sprintf("graylog%02d.example.com", n+1),
+		"lifecycle":        *lifecycle,
+		"lb_status":        lb,
+		"timezone":         "UTC",
+		"operating_system": "Linux 5.15.0",
+	}
+}
+
+// /system/journal
+func journal() map[string]interface{} {
+	uncommitted, utilization := 12, 0.4
+	if *journalFull {
+		uncommitted, utilization = 4200000, 100.0
+	}
+	return map[string]interface{}{
+		"enabled":                     true,
+		"append_events_per_second":    *throughput,
+		"read_events_per_second":      *throughput,
+		"uncommitted_journal_entries": uncommitted,
+		"journal_size":                5368709120 * utilization / 100,
+		"journal_size_limit":          5368709120,
+		"number_of_segments":          3,
+		"journal_config": map[string]interface{}{
+			"max_size":       5368709120,
+			"max_age":        43200000,
+			"flush_interval": 1000000,
+		},
+	}
+}
+
+// /cluster, nodes that are down do not answer
+func cluster() map[string]interface{} {
+	c := map[string]interface{}{}
+	for n := 0; n < *nodes; n++ {
+		if n >= *nodes-*nodesDown {
+			c[nodeID(n)] = nil
+			continue
+		}
+		c[nodeID(n)] = node(n)
+	}
+	return c
+}
+
+// /system/cluster/nodes, Graylog 4 renamed is_master to is_leader
+func clusterNodes() map[string]interface{} {
+	field := "is_leader"
+	if *major < 4 {
+		field = "is_master"
+	}
+
+	var list []interface{}
+	for n := 0; n < *nodes-*nodesDown; n++ {
+		list = append(list, map[string]interface{}{
+			"cluster_id":        "3adaf799-1551-4239-84e5-6ed939b56f62",
+			"node_id":           nodeID(n),
+			"type":              "server",
+			"transport_address": fmt.Sprintf("http://graylog%02d.example.com:9000/api/", n+1),
+			"last_seen":         time.Now().UTC().Format(time.RFC3339),
+			"short_node_id":     nodeID(n)[:8],
+			"hostname":          fmt.Sprintf("graylog%02d.example.com", n+1),
+			field:               n < *leaders,
+		})
+	}
+	return map[string]interface{}{"nodes": list, "total": len(list)}
+}
+
+// legacy collector plugin list
+func collectorList() map[string]interface{} {
+	var list []interface{}
+	for n := 0; n < *collectors; n++ {
+		status, message := 0, ""
+		if n >= *collectorsOffline && n < *collectorsOffline+*collectorsFailing {
+			status, message = 2, "filebeat: exit status 1"
+		}
+		list = append(list, map[string]interface{}{
+			"id":                fmt.Sprintf("collector-%d", n+1),
+			"node_id":           fmt.Sprintf("web%02d.example.com", n+1),
+			"collector_version": "0.1.8",
+			"last_seen":         time.Now().UTC().Format(time.RFC3339),
+			"active":            n >= *collectorsOffline,
+			"node_details": map[string]interface{}{
+				"operating_system": "Linux",
+				"status":           map[string]interface{}{"status": status, "message": message, "backends": map[string]interface{}{}},
+			},
+		})
+	}
+	return map[string]interface{}{"collectors": list, "total": len(list)}
+}
+
+// enterprise forwarder list
+func forwarderList() map[string]interface{} {
+	var list []interface{}
+	for n := 0; n < *forwarders; n++ {
+		state := "RUNNING"
+		if n >= *forwardersDisconnected && n < *forwardersDisconnected+*forwarderInputsFailing {
+			state = "FAILED"
+		}
+		list = append(list, map[string]interface{}{
+			"id":               fmt.Sprintf("forwarder-%d", n+1),
+			"title":            fmt.Sprintf("edge-%d", n+1),
+			"hostname":         fmt.Sprintf("fw%02d.example.com", n+1),
+			"is_online":        n >= *forwardersDisconnected,
+			"input_profile_id": "default",
+			"inputs":           []interface{}{map[string]interface{}{"title": "beats", "state": state}},
+		})
+	}
+	return map[string]interface{}{"forwarders": list, "total": len(list)}
+}
+
+// id of the n-th stream
+func streamID(n int) string {
+	return fmt.Sprintf("%024d", n+1)
+}
+
+// whether id is one of the canned streams
+func knownStream(id string) bool {
+	for n := 0; n < *streams; n++ {
+		if streamID(n) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// /streams
+func streamList() map[string]interface{} {
+	var list []interface{}
+	for n := 0; n < *streams; n++ {
+		list = append(list, map[string]interface{}{
+			"id":          streamID(n),
+			"title":       fmt.Sprintf("Stream %d", n+1),
+			"description": "canned stream",
+			"disabled":    n < *streamsPaused,
+			"rules":       []interface{}{},
+		})
+	}
+	return map[string]interface{}{"streams": list, "total": len(list)}
+}
+
+// /system/metrics/namespace/<ns>, the stream router timers in microseconds
+// next to a meter per stream, 404 when nothing matches like Graylog
+func metricsNamespace(ns string) (interface{}, bool) {
+	var list []interface{}
+	for n := 0; n < *streams; n++ {
+		name := "org.graylog2.plugin.streams.Stream." + streamID(n)
+		p95 := float64(*streamExecutionTime) / float64(time.Microsecond)
+		list = append(list, map[string]interface{}{
+			"full_name": name + ".ExecutionTime",
+			"name":      "ExecutionTime",
+			"type":      "timer",
+			"metric": map[string]interface{}{
+				"time": map[string]interface{}{
+					"min":             p95 / 10,
+					"mean":            p95 / 2,
+					"std_dev":         p95 / 4,
+					"95th_percentile": p95,
+					"98th_percentile": p95 * 1.1,
+					"99th_percentile": p95 * 1.2,
+					"max":             p95 * 2,
+				},
+				"rate": map[string]interface{}{
+					"total":          *events / (*streams),
+					"mean":           *streamThroughput,
+					"one_minute":     *streamThroughput,
+					"five_minute":    *streamThroughput,
+					"fifteen_minute": *streamThroughput,
+				},
+				"duration_unit": "microseconds",
+				"rate_unit":     "events/second",
+			},
+		}, map[string]interface{}{
+			"full_name": name + ".incomingMessages",
+			"name":      "incomingMessages",
+			"type":      "meter",
+			"metric": map[string]interface{}{
+				"rate":      map[string]interface{}{"total": *events / (*streams), "mean": *streamThroughput},
+				"rate_unit": "events/second",
+			},
+		})
+	}
+
+	var matched []interface{}
+	for _, m := range list {
+		if strings.HasPrefix(m.(map[string]interface{})["full_name"].(string), ns) {
+			matched = append(matched, m)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, false
+	}
+	return map[string]interface{}{"metrics": matched, "total": len(matched)}, true
+}
+
+// /system/notifications, one per stream paused by the fault counter
+func notificationList() map[string]interface{} {
+	var list []interface{}
+	for n := 0; n < *streamsPaused && n < *streams; n++ {
+		list = append(list, map[string]interface{}{
+			"type":      "stream_processing_disabled",
+			"severity":  "normal",
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"node_id":   nodeID(0),
+			"details": map[string]interface{}{
+				"stream_id":    streamID(n),
+				"stream_title": fmt.Sprintf("Stream %d", n+1),
+				"fault_count":  3,
+			},
+		})
+	}
+	return map[string]interface{}{"notifications": list, "total": len(list)}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// set a toggle for the duration of a test
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	previous := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.Set(name, previous) })
+}
+
+// request path from the mock, decoding the JSON body
+func get(t *testing.T, ts *httptest.Server, path string) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest("GET", ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("admin", "secret")
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return res.StatusCode, data
+}
+
+func TestVersions(t *testing.T) {
+	tests := []struct {
+		version    string
+		prefix     string
+		leader     string
+		collectors int
+	}{
+		{"2", "", "is_master", http.StatusOK},
+		{"3", "/api", "is_master", http.StatusNotFound},
+		{"4", "/api", "is_leader", http.StatusNotFound},
+		{"5", "/api", "is_leader", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			setFlag(t, "graylog-version", tt.version)
+			ts := httptest.NewServer(handler())
+			defer ts.Close()
+
+			code, system := get(t, ts, tt.prefix+"/system")
+			if code != http.StatusOK || system["is_processing"] != true || system["lb_status"] != "alive" {
+				t.Errorf("/system = %d %v", code, system)
+			}
+			if tt.prefix == "" {
+				if code, _ := get(t, ts, "/api/system"); code != http.StatusNotFound {
+					t.Errorf("/api/system = %d on Graylog 2", code)
+				}
+			}
+
+			_, nodes := get(t, ts, tt.prefix+"/system/cluster/nodes")
+			node := nodes["nodes"].([]interface{})[0].(map[string]interface{})
+			if node[tt.leader] != true {
+				t.Errorf("first node has no %s: %v", tt.leader, node)
+			}
+
+			if code, _ := get(t, ts, tt.prefix+"/plugins/org.graylog.plugins.collector/collectors"); code != tt.collectors {
+				t.Errorf("collectors = %d, want %d", code, tt.collectors)
+			}
+		})
+	}
+}
+
+func TestJournalFull(t *testing.T) {
+	setFlag(t, "journal-full", "true")
+	ts := httptest.NewServer(handler())
+	defer ts.Close()
+
+	if _, system := get(t, ts, "/system"); system["lb_status"] != "throttled" {
+		t.Errorf("lb_status = %v, want throttled", system["lb_status"])
+	}
+	_, journal := get(t, ts, "/system/journal")
+	if journal["journal_size"] != journal["journal_size_limit"] {
+		t.Errorf("journal is not full: %v", journal)
+	}
+}
+
+func TestNodesDown(t *testing.T) {
+	setFlag(t, "nodes", "3")
+	setFlag(t, "nodes-down", "1")
+	ts := httptest.NewServer(handler())
+	defer ts.Close()
+
+	_, cluster := get(t, ts, "/cluster")
+	down := 0
+	for _, n := range cluster {
+		if n == nil {
+			down++
+		}
+	}
+	if len(cluster) != 3 || down != 1 {
+		t.Errorf("/cluster has %d nodes and %d down, want 3 and 1", len(cluster), down)
+	}
+
+	_, nodes := get(t, ts, "/system/cluster/nodes")
+	if nodes["total"] != 2.0 {
+		t.Errorf("/system/cluster/nodes total = %v, want 2", nodes["total"])
+	}
+}
+
+func TestCollectorsOffline(t *testing.T) {
+	setFlag(t, "collectors", "4")
+	setFlag(t, "collectors-offline", "2")
+	setFlag(t, "collectors-failing", "1")
+	ts := httptest.NewServer(handler())
+	defer ts.Close()
+
+	_, list := get(t, ts, "/plugins/org.graylog.plugins.collector/collectors")
+	inactive, failing := 0, 0
+	for _, c := range list["collectors"].([]interface{}) {
+		c := c.(map[string]interface{})
+		if c["active"] != true {
+			inactive++
+			continue
+		}
+		status := c["node_details"].(map[string]interface{})["status"].(map[string]interface{})["status"]
+		if status != 0.0 {
+			failing++
+		}
+	}
+	if inactive != 2 || failing != 1 {
+		t.Errorf("%d inactive and %d failing collectors, want 2 and 1", inactive, failing)
+	}
+}
+
+func TestAuthAndFailures(t *testing.T) {
+	setFlag(t, "u", "admin")
+	setFlag(t, "p", "other")
+	ts := httptest.NewServer(handler())
+	defer ts.Close()
+
+	if code, _ := get(t, ts, "/system"); code != http.StatusUnauthorized {
+		t.Errorf("wrong password = %d, want 401", code)
+	}
+
+	setFlag(t, "p", "secret")
+	setFlag(t, "fail", "503")
+	if code, _ := get(t, ts, "/system"); code != http.StatusServiceUnavailable {
+		t.Errorf("-fail 503 = %d", code)
+	}
+}
+
+func TestToggleAtRuntime(t *testing.T) {
+	setFlag(t, "lifecycle", "running")
+	ts := httptest.NewServer(handler())
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/_mock/set?lifecycle=halting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if _, system := get(t, ts, "/system"); system["lifecycle"] != "halting" {
+		t.Errorf("lifecycle = %v after /_mock/set", system["lifecycle"])
+	}
+
+	res, err = http.Get(ts.URL + "/_mock/set?bogus=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown toggle = %d, want 400", res.StatusCode)
+	}
+}
+
+func TestRecordedResponses(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "system_throughput.json"), []byte(`{"throughput":42}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, "responses", dir)
+	ts := httptest.NewServer(handler())
+	defer ts.Close()
+
+	if _, tput := get(t, ts, "/system/throughput"); tput["throughput"] != 42.0 {
+		t.Errorf("recorded throughput = %v, want 42", tput["throughput"])
+	}
+	if _, total := get(t, ts, "/count/total"); total["events"] == nil {
+		t.Error("canned response missing next to recorded ones")
+	}
+}
+
+func TestMetricsNamespace(t *testing.T) {
+	setFlag(t, "streams", "2")
+	setFlag(t, "stream-execution-time", "7ms")
+	ts := httptest.NewServer(handler())
+	defer ts.Close()
+
+	code, ns := get(t, ts, "/system/metrics/namespace/org.graylog2.plugin.streams.Stream")
+	if code != http.StatusOK || ns["total"] != 4.0 {
+		t.Fatalf("namespace = %d %v, want a timer and a meter per stream", code, ns)
+	}
+	timer := ns["metrics"].([]interface{})[0].(map[string]interface{})["metric"].(map[string]interface{})
+	if p95 := timer["time"].(map[string]interface{})["95th_percentile"]; p95 != 7000.0 || timer["duration_unit"] != "microseconds" {
+		t.Errorf("timer %v, want 7000 microseconds", timer)
+	}
+
+	if code, _ := get(t, ts, "/system/metrics/namespace/org.graylog2.shared"); code != http.StatusNotFound {
+		t.Errorf("unknown namespace = %d, want 404", code)
+	}
+	setFlag(t, "streams", "0")
+	if code, _ := get(t, ts, "/system/metrics/namespace/org.graylog2.plugin.streams.Stream"); code != http.StatusNotFound {
+		t.Errorf("namespace without streams = %d, want 404", code)
+	}
+}
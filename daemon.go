@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// latest exposition, replaced after every collection
+var (
+	exposition     []byte
+	expositionLock sync.RWMutex
+)
+
+// characters not allowed in prometheus metric names
+var invalidMetricName = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// run the collection loop and expose the results on /metrics, never returns
+func serve(endpoints []string) {
+	go func() {
+		for {
+			collect(endpoints)
+			time.Sleep(*interval)
+		}
+	}()
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		expositionLock.RLock()
+		defer expositionLock.RUnlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(exposition)
+	})
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<html><head><title>check_graylog2 exporter</title></head><body><a href="/metrics">Metrics</a></body></html>`)
+	})
+
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+// run all checks once and keep the rendered results
+func collect(endpoints []string) {
+	o := check(endpoints)
+
+	if len(debug) != 0 && o.err != nil {
+		log.Println(o.err)
+	}
+
+	b := render(o.status)
+
+	expositionLock.Lock()
+	exposition = b
+	expositionLock.Unlock()
+}
+
+// results of the last run in prometheus text format
+func render(status int) []byte {
+	var b bytes.Buffer
+	up := 0
+	if completed {
+		up = 1
+	}
+	gauge(&b, "graylog_up", "Whether the last collection completed against the Graylog2 API.")
+	fmt.Fprintf(&b, "graylog_up %d\n", up)
+
+	gauge(&b, "graylog_status", "Overall nagios state of the last collection (0=OK, 1=WARNING, 2=CRITICAL, 3=UNKNOWN).")
+	fmt.Fprintf(&b, "graylog_status %d\n", status)
+
+	gauge(&b, "graylog_check_status", "Nagios state of each sub-check (0=OK, 1=WARNING, 2=CRITICAL, 3=UNKNOWN).")
+	for _, r := range results {
+		fmt.Fprintf(&b, "graylog_check_status{check=%q} %d\n", r.name, r.status)
+	}
+
+	// without a completed run the zero defaults would be misleading
+	if completed {
+		for _, m := range metrics {
+			name := "graylog_" + invalidMetricName.ReplaceAllString(m.label, "_")
+			gauge(&b, name, fmt.Sprintf("Graylog2 performance data value %s.", m.label))
+			fmt.Fprintf(&b, "%s %v\n", name, m.value)
+		}
+	}
+
+	gauge(&b, "graylog_last_collection_timestamp_seconds", "Unix time of the last collection.")
+	fmt.Fprintf(&b, "graylog_last_collection_timestamp_seconds %d\n", time.Now().Unix())
+
+	return b.Bytes()
+}
+
+// write HELP and TYPE lines of a gauge
+func gauge(b *bytes.Buffer, name, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// node_exporter textfile collector output, replaces the file atomically
+func textfileOutput(status int, message string, err error) {
+	if err := writeTextfile(render(status)); err != nil {
+		fmt.Fprintf(os.Stderr, "Can not write textfile: %v\n", err)
+		os.Exit(UNKNOWN)
+	}
+}
+
+// write the textfile via a temporary file in the same directory
+func writeTextfile(data []byte) error {
+	return writeAtomic(*textfileDir, *textfileName, data, 0644)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// lower case names of hosts in downtime, loaded once per run
+var downtimeHosts map[string]bool
+
+// whether the host of a collector has a scheduled downtime in -downtime-source
+func inDowntime(host string) bool {
+	if len(*downtimeSource) == 0 || len(host) == 0 {
+		return false
+	}
+
+	if downtimeHosts == nil {
+		hosts, err := downtimes()
+		if err != nil {
+			// count the collectors as usual
+			detail(fmt.Sprintf("Can not read downtimes: %v", err))
+			hosts = []string{}
+		}
+
+		downtimeHosts = map[string]bool{}
+		for _, h := range hosts {
+			h = strings.ToLower(h)
+			downtimeHosts[h] = true
+			downtimeHosts[strings.SplitN(h, ".", 2)[0]] = true
+		}
+	}
+
+	host = strings.ToLower(host)
+	return downtimeHosts[host] || downtimeHosts[strings.SplitN(host, ".", 2)[0]]
+}
+
+// hosts with a scheduled downtime, from the Icinga2 API or Nagios statusjson.cgi
+func downtimes() ([]string, error) {
+	source := strings.TrimRight(*downtimeSource, "/")
+	nagios := strings.Contains(source, "statusjson.cgi")
+	if nagios {
+		source += "?query=downtimelist&details=true"
+	} else {
+		source += "/v1/objects/hosts?attrs=name&filter=" + url.QueryEscape("host.downtime_depth>0")
+	}
+
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(*downtimeUser, *downtimePass)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := coreClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP code %v", res.StatusCode)
+	}
+
+	var hosts []string
+	if nagios {
+		var reply struct {
+			Data struct {
+				Downtimelist map[string]struct {
+					HostName    string `json:"host_name"`
+					Description string `json:"service_description"`
+					IsInEffect  bool   `json:"is_in_effect"`
+				} `json:"downtimelist"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &reply); err != nil {
+			return nil, err
+		}
+		for _, d := range reply.Data.Downtimelist {
+			if d.IsInEffect && len(d.Description) == 0 {
+				hosts = append(hosts, d.HostName)
+			}
+		}
+		return hosts, nil
+	}
+
+	var reply struct {
+		Results []struct {
+			Name string `json:"name"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, err
+	}
+	for _, h := range reply.Results {
+		hosts = append(hosts, h.Name)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// monitoring core replying body to authenticated downtime queries
+func downtimeFixture(t *testing.T, body string) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "monitor" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	setFlag(t, "downtime-user", "monitor")
+	setFlag(t, "downtime-password", "secret")
+	return ts
+}
+
+func TestDowntimesIcinga2(t *testing.T) {
+	ts := downtimeFixture(t, `{"results": [
+		{"name": "web01.example.com", "type": "Host", "attrs": {"name": "web01.example.com"}},
+		{"name": "db01", "type": "Host", "attrs": {"name": "db01"}}
+	]}`)
+	setFlag(t, "downtime-source", ts.URL+"/")
+
+	hosts, err := downtimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"web01.example.com", "db01"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("got %q, want %q", hosts, want)
+	}
+}
+
+func TestDowntimesNagios(t *testing.T) {
+	ts := downtimeFixture(t, `{"data": {"downtimelist": {
+		"1": {"host_name": "web01", "is_in_effect": true},
+		"2": {"host_name": "web02", "is_in_effect": false},
+		"3": {"host_name": "db01", "service_description": "Disk", "is_in_effect": true},
+		"4": {"host_name": "mq01.example.com", "service_description": "", "is_in_effect": true}
+	}}}`)
+	setFlag(t, "downtime-source", ts.URL+"/nagios/cgi-bin/statusjson.cgi")
+
+	hosts, err := downtimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(hosts)
+	if want := []string{"mq01.example.com", "web01"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("got %q, want only host downtimes in effect %q", hosts, want)
+	}
+}
+
+func TestDowntimesAuth(t *testing.T) {
+	ts := downtimeFixture(t, `{"results": []}`)
+	setFlag(t, "downtime-source", ts.URL)
+	setFlag(t, "downtime-password", "wrong")
+	setFlag(t, "icinga2-user", "monitor")
+	setFlag(t, "icinga2-password", "secret")
+
+	if _, err := downtimes(); err == nil || err.Error() != "HTTP code 401" {
+		t.Errorf("error = %v, want the own credentials of -downtime-source", err)
+	}
+}
+
+func TestInDowntime(t *testing.T) {
+	ts := downtimeFixture(t, `{"results": [{"name": "Web01.example.com"}]}`)
+	setFlag(t, "downtime-source", ts.URL)
+	downtimeHosts = nil
+	t.Cleanup(func() { downtimeHosts = nil })
+
+	for host, want := range map[string]bool{"web01": true, "WEB01.example.com": true, "web01.other.net": true, "web02": false, "": false} {
+		if got := inDowntime(host); got != want {
+			t.Errorf("inDowntime(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
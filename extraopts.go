@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// plugins.ini locations searched when --extra-opts names no file
+var extraOptsPaths = []string{
+	"/etc/nagios/plugins.ini",
+	"/usr/local/nagios/etc/plugins.ini",
+	"/usr/local/etc/nagios/plugins.ini",
+	"/etc/opt/nagios/plugins.ini",
+	"/etc/nagios-plugins.ini",
+	"/usr/local/etc/nagios-plugins.ini",
+	"/etc/opt/nagios-plugins.ini",
+}
+
+// replace --extra-opts=[section][@file] arguments by the options of the ini
+// section, placed in front so the command line still wins
+func extraOpts(args []string) ([]string, error) {
+	var opts, rest []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name != "extra-opts" && !strings.HasPrefix(name, "extra-opts=") {
+			rest = append(rest, arg)
+			continue
+		}
+
+		// the value may also follow as the next argument like other flags
+		value, given := "", false
+		if j := strings.Index(name, "="); j >= 0 {
+			value, given = name[j+1:], true
+		} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			value, given = args[i], true
+		}
+
+		section, file := filepath.Base(os.Args[0]), ""
+		if given {
+			if j := strings.Index(value, "@"); j >= 0 {
+				value, file = value[:j], value[j+1:]
+			}
+			if value != "" {
+				section = value
+			}
+		}
+
+		o, err := loadExtraOpts(section, file)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, o...)
+	}
+
+	// repeatable flags accumulate, so given on the command line they replace the ini values
+	given := map[string]bool{}
+	for _, arg := range rest {
+		if arg == "--" {
+			break
+		}
+		given[optName(arg)] = true
+	}
+	var kept []string
+	for _, o := range opts {
+		if name := optName(o); repeatableFlags[name] && given[name] {
+			continue
+		}
+		kept = append(kept, o)
+	}
+
+	return append(kept, rest...), nil
+}
+
+// flags collecting every value instead of keeping the last one
+var repeatableFlags = map[string]bool{"l": true, "stream": true, "map-state": true}
+
+// flag name of an argument, empty for values
+func optName(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return ""
+	}
+	name := strings.TrimLeft(arg, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// read the options of an ini section as command line arguments
+func loadExtraOpts(section, file string) ([]string, error) {
+	if file == "" {
+		paths := extraOptsPaths
+		if env := os.Getenv("NAGIOS_CONFIG_PATH"); env != "" {
+			paths = nil
+			for _, dir := range filepath.SplitList(env) {
+				paths = append(paths, filepath.Join(dir, "plugins.ini"), filepath.Join(dir, "nagios-plugins.ini"))
+			}
+		}
+		for _, p := range paths {
+			if _, err := os.Stat(p); err == nil {
+				file = p
+				break
+			}
+		}
+		if file == "" {
+			return nil, fmt.Errorf("no plugins.ini found for --extra-opts")
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var opts []string
+	found, current := false, ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || current == section
+			continue
+		}
+		if current != section {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) == 1 {
+			opts = append(opts, "--"+key)
+			continue
+		}
+		opts = append(opts, "--"+key+"="+unquote(strings.TrimSpace(kv[1])))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("section [%s] not found in %s", section, file)
+	}
+
+	return opts, nil
+}
+
+// strip matching quotes around ini values
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
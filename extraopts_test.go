@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// plugins.ini in a temporary directory
+func iniFixture(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "plugins.ini")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestExtraOpts(t *testing.T) {
+	section := filepath.Base(os.Args[0])
+	file := iniFixture(t, `
+; credentials of the check
+[check_graylog]
+u = admin
+p = "se=cret"
+insecure
+
+[`+section+`]
+l = http://default:9000/api
+l = http://other:9000/api
+stream = 5a1b2c3d:10:20
+`)
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		err  string
+	}{
+		{
+			name: "equal sign",
+			args: []string{"--extra-opts=check_graylog@" + file, "-l", "http://graylog:9000/api"},
+			want: []string{"--u=admin", "--p=se=cret", "--insecure", "-l", "http://graylog:9000/api"},
+		},
+		{
+			name: "separate value",
+			args: []string{"-extra-opts", "check_graylog@" + file, "-ex", "2"},
+			want: []string{"--u=admin", "--p=se=cret", "--insecure", "-ex", "2"},
+		},
+		{
+			name: "file only",
+			args: []string{"--extra-opts=@" + file},
+			want: []string{"--l=http://default:9000/api", "--l=http://other:9000/api", "--stream=5a1b2c3d:10:20"},
+		},
+		{
+			name: "repeatable flag on the command line",
+			args: []string{"--extra-opts=@" + file, "-l=http://graylog:9000/api"},
+			want: []string{"--stream=5a1b2c3d:10:20", "-l=http://graylog:9000/api"},
+		},
+		{
+			name: "after the terminator",
+			args: []string{"-u", "admin", "--", "--extra-opts=check_graylog@" + file},
+			want: []string{"-u", "admin", "--", "--extra-opts=check_graylog@" + file},
+		},
+		{
+			name: "missing section",
+			args: []string{"--extra-opts=bogus@" + file},
+			err:  "section [bogus] not found in " + file,
+		},
+		{
+			name: "missing file",
+			args: []string{"--extra-opts=check_graylog@" + file + ".missing"},
+			err:  "no such file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extraOpts(tt.args)
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// point NAGIOS_CONFIG_PATH elsewhere for the duration of a test
+func setConfigPath(t *testing.T, value string) {
+	t.Helper()
+	previous, set := os.LookupEnv("NAGIOS_CONFIG_PATH")
+	os.Setenv("NAGIOS_CONFIG_PATH", value)
+	t.Cleanup(func() {
+		if set {
+			os.Setenv("NAGIOS_CONFIG_PATH", previous)
+		} else {
+			os.Unsetenv("NAGIOS_CONFIG_PATH")
+		}
+	})
+}
+
+func TestExtraOptsConfigPath(t *testing.T) {
+	empty, file := t.TempDir(), iniFixture(t, "[check_graylog]\nu=admin\n")
+	setConfigPath(t, empty+string(os.PathListSeparator)+filepath.Dir(file))
+
+	got, err := extraOpts([]string{"--extra-opts=check_graylog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--u=admin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	setConfigPath(t, empty)
+	if _, err := extraOpts([]string{"--extra-opts=check_graylog"}); err == nil || err.Error() != "no plugins.ini found for --extra-opts" {
+		t.Errorf("error = %v without any plugins.ini", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// alert on disconnected forwarders and forwarder inputs that are not running
+func checkForwarders(list map[string]interface{}) {
+	var disconnected, failing []string
+	total := 0
+
+	entries, _ := list["forwarders"].([]interface{})
+	for _, v := range entries {
+		forwarder, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		total++
+
+		name := fmt.Sprintf("%v", forwarder["title"])
+		if host, ok := forwarder["hostname"].(string); ok && len(host) > 0 {
+			name += " (" + host + ")"
+		}
+
+		if !forwarderOnline(forwarder) {
+			disconnected = append(disconnected, fmt.Sprintf("forwarder %s is disconnected", name))
+			continue
+		}
+
+		inputs, _ := forwarder["inputs"].([]interface{})
+		for _, i := range inputs {
+			input, ok := i.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if state, _ := input["state"].(string); len(state) > 0 && !strings.EqualFold(state, "RUNNING") {
+				failing = append(failing, fmt.Sprintf("forwarder %s input %v is %s", name, input["title"], strings.ToLower(state)))
+			}
+		}
+	}
+
+	perf("forwarders", float64(total))
+	perf("forwarder_disconnected", float64(len(disconnected)))
+	perf("forwarder_input_failures", float64(len(failing)))
+
+	switch {
+	case len(disconnected) > 0 && len(failing) > 0:
+		report("forwarders", CRITICAL, fmt.Sprintf("%d forwarders are disconnected and %d forwarder inputs are failing", len(disconnected), len(failing)))
+	case len(disconnected) > 0:
+		report("forwarders", CRITICAL, fmt.Sprintf("%d forwarders are disconnected", len(disconnected)))
+	case len(failing) > 0:
+		report("forwarders", WARNING, fmt.Sprintf("%d forwarder inputs are failing", len(failing)))
+	default:
+		report("forwarders", OK, fmt.Sprintf("%d forwarders are connected", total))
+	}
+	detail(disconnected...)
+	detail(failing...)
+}
+
+// connection state of a forwarder, newer versions report a state instead of a flag
+func forwarderOnline(forwarder map[string]interface{}) bool {
+	if online, ok := forwarder["is_online"].(bool); ok {
+		return online
+	}
+	if state, ok := forwarder["state"].(string); ok {
+		return strings.EqualFold(state, "CONNECTED") || strings.EqualFold(state, "RUNNING")
+	}
+	return false
+}
@@ -0,0 +1,3 @@
+module github.com/Bourne-ID/nagios-check-graylog2
+
+go 1.16
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// send the result to the process-check-result action of the Icinga2 API
+func icinga2Submit(status int, message string) error {
+	if *icinga2URL == "" {
+		return nil
+	}
+
+	host := thisHost(*submitHost)
+	service := *icinga2Service
+	if service == "" {
+		service = *submitService
+	}
+	source := thisHost("")
+
+	var performance []string
+	for _, m := range metrics {
+		performance = append(performance, m.String())
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type":             "Service",
+		"filter":           "host.name==h && service.name==s",
+		"filter_vars":      map[string]string{"h": host, "s": service},
+		"exit_status":      status,
+		"plugin_output":    plainText(status, message),
+		"performance_data": performance,
+		"check_source":     source,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(*icinga2URL, "/")+"/v1/actions/process-check-result", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("Can not parse Icinga2 URL: %v", err)
+	}
+	req.SetBasicAuth(*icinga2User, *icinga2Pass)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := coreClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("Can not connect to Icinga2 API: %v", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("No response received from Icinga2 API: %v", err)
+	}
+	if len(debug) != 0 {
+		fmt.Fprintln(os.Stderr, string(body))
+	}
+
+	var reply struct {
+		Results []struct {
+			Code   float64 `json:"code"`
+			Status string  `json:"status"`
+		} `json:"results"`
+		Status string `json:"status"`
+	}
+	json.Unmarshal(body, &reply)
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("Icinga2 API replied with HTTP code %v: %s", res.StatusCode, reply.Status)
+	}
+	if len(reply.Results) == 0 {
+		return fmt.Errorf("Icinga2 API found no service %s!%s", host, service)
+	}
+	for _, r := range reply.Results {
+		if r.Code != 200 {
+			return fmt.Errorf("Icinga2 API replied with code %v: %s", r.Code, r.Status)
+		}
+	}
+
+	return nil
+}
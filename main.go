@@ -9,12 +9,17 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"runtime"
 	"strings"
 	"time"
 	"net"
+	"sort"
 	"strconv"
 )
 
+// request timeout of -mode quick unless -timeout is given
+const quickTimeout = 5 * time.Second
+
 // nagios exit codes
 const (
 	OK = iota
@@ -37,7 +42,7 @@ const (
 
 var (
 	// command line arguments
-	link *string
+	links = &urlList{urls: []string{"http://localhost:12900"}}
 	user *string
 	pass *string
 	version *bool
@@ -46,7 +51,7 @@ var (
 	// env debugging variable
 	debug string
 	// performance data
-	pdata string
+	metrics []metric
 	// version value
 	id string
 	// collector warn threshold
@@ -55,71 +60,288 @@ var (
 	collectorCT *int
 	// expected number of collectors
 	expectedCollectors *int
+	// treat every warning as ok
+	warnAsOK *bool
+	// treat every unknown as critical
+	unknownAsCritical *bool
+	// per condition state overrides
+	stateMapping = stateMap{}
+	// expected number of active cluster nodes
+	expectedNodes *int
+	// elapsed time thresholds
+	timeWT *time.Duration
+	timeCT *time.Duration
+	// verify the cluster has a single leader
+	leader *bool
+	// output format
+	output *string
+	// node_exporter textfile collector target
+	textfileDir *string
+	textfileName *string
+	// output size limit
+	maxOutput *int
+	// zabbix item host and trapper address
+	zabbixHost *string
+	zabbixServer *string
+	// passive check submission
+	submitURL *string
+	submitHost *string
+	submitService *string
+	nscaPassword *string
+	nscaEncryption *string
+	nscaOutputLength *int
+	nrdpToken *string
+	// icinga2 api submission
+	icinga2URL *string
+	icinga2User *string
+	icinga2Pass *string
+	icinga2Service *string
+	// SRV record discovery of API endpoints
+	discover *string
+	discoverScheme *string
+	discoverPath *string
+	// clusters checked in one invocation
+	targetsFile *string
+	// response cache shared by frequent runs
+	cacheTTL *time.Duration
+	cacheDir *string
+	// monitoring core asked for host downtimes
+	downtimeSource *string
+	downtimeUser *string
+	downtimePass *string
+	// streams to check
+	streams = streamList{}
+	streamAlerts *bool
+	// quick checks only /system
+	mode *string
+	// stream rule matching
+	streamRouting *bool
+	streamTimeWT *time.Duration
+	streamTimeCT *time.Duration
+	// enterprise forwarder status
+	forwarders *bool
+	// Graylog Cloud tenant
+	cloud *bool
+	// API access token instead of username and password
+	token *string
+	tokenType *string
+	// api request timeout
+	timeout *time.Duration
+	// prometheus exporter mode
+	daemon *bool
+	listen *string
+	interval *time.Duration
+	// sub-check results
+	results []result
+	// long output lines
+	details []string
+	// set when the last run was not stopped by abort
+	completed bool
+	// API endpoint of the last run
+	endpoint string
 )
 
-// handle performance data output
-func perf(elapsed, total, inputs, tput, index, collectors, failureCollectors, offlineCollectors  float64) {
-	pdata = fmt.Sprintf("time=%f;;;; total=%.f;;;; sources=%.f;;;; throughput=%.f;;;; index_failures=%.f;;;; collectors=%.f;;;; collector_failure=%.f;;;; collector_offline=%.f;;;;", elapsed, total, inputs, tput, index, collectors, failureCollectors, offlineCollectors)
+// result of a single sub-check
+type result struct {
+	name    string
+	status  int
+	message string
+}
+
+// performance data value
+type metric struct {
+	label string
+	value float64
+	warn  string
+	crit  string
+}
+
+func (m metric) String() string {
+	return fmt.Sprintf("%s=%s;%s;%s;;", m.label, strconv.FormatFloat(m.value, 'f', -1, 64), m.warn, m.crit)
+}
+
+// handle performance data output, keeping the order of first appearance
+func perf(label string, value float64) {
+	for i := range metrics {
+		if metrics[i].label == label {
+			metrics[i].value = value
+			return
+		}
+	}
+	metrics = append(metrics, metric{label: label, value: value})
+}
+
+// set performance data thresholds
+func thresholds(label, warn, crit string) {
+	for i := range metrics {
+		if metrics[i].label == label {
+			metrics[i].warn, metrics[i].crit = warn, crit
+		}
+	}
+}
+
+// performance data as printed after the pipe
+func pdata() string {
+	var s []string
+	for _, m := range metrics {
+		s = append(s, m.String())
+	}
+	return strings.Join(s, " ")
 }
 
 // handle args
 func init() {
-	link = flag.String("l", "http://localhost:12900", "Graylog2 API URL - REQUIRED")
+	flag.Var(links, "l", "Graylog2 API URL, repeatable or comma separated for failover - REQUIRED")
 	user = flag.String("u", "", "API username - REQUIRED")
 	pass = flag.String("p", "", "API password - REQUIRED")
+	flag.Var(&streams, "stream", "Check the throughput of a stream: <id>[:warn:crit] (repeatable)")
+	streamAlerts = flag.Bool("stream-alerts", false, "Alert on triggered alert conditions of the -stream streams (Graylog 2).")
+	mode = flag.String("mode", "full", "Check mode: full, quick (only /system, for frequent scheduling)")
+	streamRouting = flag.Bool("stream-routing", false, "Check stream rule execution time and streams paused by the fault counter.")
+	streamTimeWT = flag.Duration("stream-time-warn", 0, "Warn when the slowest stream takes longer to match, e.g. 5ms")
+	streamTimeCT = flag.Duration("stream-time-crit", 0, "Critical when the slowest stream takes longer to match, e.g. 50ms")
+	forwarders = flag.Bool("forwarders", false, "Check the Graylog Forwarders (enterprise and cloud).")
+	token = flag.String("token", "", "API access token, replaces -u and -p")
+	tokenType = flag.String("token-type", "token", "Send the access token as: token (basic auth), bearer")
+	cloud = flag.Bool("cloud", false, "Graylog Cloud: optional port, /api base path, no node local checks.")
 	ssl = flag.Bool("insecure", false, "Accept insecure SSL/TLS certificates.")
 	version = flag.Bool("version", false, "Display version and license information.")
+	// handled by extraOpts before parsing, registered for the usage only
+	flag.String("extra-opts", "", "Read options from a plugins.ini section: [section][@file]")
 	expectedCollectors = flag.Int("ex", 0, "Expected Number of Collectors")
 	collectorWT = flag.Int("wt", 1, "Collection Warning Threshold")
 	collectorCT = flag.Int("ct", 2, "Collection Critical Threshold")
+	expectedNodes = flag.Int("expected-nodes", 0, "Expected number of active cluster nodes")
+	timeWT = flag.Duration("time-warn", 0, "Warn when the check takes longer, e.g. 10s")
+	timeCT = flag.Duration("time-crit", 0, "Critical when the check takes longer, e.g. 20s")
+	leader = flag.Bool("leader", false, "Verify exactly one node is the cluster leader.")
+	output = flag.String("output", "nagios", "Output format: "+formats())
+	maxOutput = flag.Int("max-output-bytes", 1023, "Truncate nagios output to this size, 0 for no limit (NRPE 2 allows 1023, NRPE 3 and newer 65535)")
+	textfileDir = flag.String("textfile-dir", "", "node_exporter textfile collector directory for -output textfile")
+	textfileName = flag.String("textfile-name", "check_graylog2.prom", "File name for -output textfile")
+	discover = flag.String("discover", "", "Discover API endpoints from DNS, e.g. srv:_graylog-api._tcp.example.com")
+	discoverScheme = flag.String("discover-scheme", "http", "Scheme of discovered API endpoints")
+	discoverPath = flag.String("discover-path", "", "Path of discovered API endpoints, e.g. /api")
+	targetsFile = flag.String("targets-file", "", "Check every cluster of this YAML file and report the worst state")
+	cacheTTL = flag.Duration("cache-ttl", 0, "Reuse API responses younger than this, e.g. 30s (default: no cache)")
+	cacheDir = flag.String("cache-dir", defaultCacheDir(), "Directory of the response cache, only used when owned by this user with mode 0700")
+	downtimeSource = flag.String("downtime-source", "", "Skip inactive collectors whose host is in downtime, Icinga2 API or Nagios statusjson.cgi URL")
+	downtimeUser = flag.String("downtime-user", "", "Username of -downtime-source")
+	downtimePass = flag.String("downtime-password", "", "Password of -downtime-source")
+	timeout = flag.Duration("timeout", 0, "Timeout of each API request, e.g. 10s (default: none, -interval in daemon mode)")
+	daemon = flag.Bool("daemon", false, "Run as Prometheus exporter instead of a single check.")
+	listen = flag.String("listen", ":9833", "Exporter listen address")
+	interval = flag.Duration("interval", time.Minute, "Exporter collection interval")
+	zabbixHost = flag.String("zabbix-host", "", "Zabbix host name of the items (default: agent Hostname, or this host when sending)")
+	zabbixServer = flag.String("zabbix-server", "", "Send the items to this Zabbix trapper, e.g. zabbix:10051")
+	submitURL = flag.String("submit", "", "Submit a passive check result to nsca://host:5667 or an NRDP URL")
+	submitHost = flag.String("submit-host", "", "Host name of the passive check result (default: this host)")
+	submitService = flag.String("submit-service", "Graylog", "Service name of the passive check result")
+	nscaPassword = flag.String("nsca-password", "", "NSCA password")
+	nscaEncryption = flag.String("nsca-encryption", "none", "NSCA encryption: none, xor")
+	nscaOutputLength = flag.Int("nsca-output-length", 512, "NSCA plugin output length, 4096 for NSCA 2.9 and newer")
+	nrdpToken = flag.String("nrdp-token", "", "NRDP token")
+	icinga2URL = flag.String("icinga2-url", "", "Submit the result to the Icinga2 API, e.g. https://icinga:5665")
+	icinga2User = flag.String("icinga2-user", "", "Icinga2 API username")
+	icinga2Pass = flag.String("icinga2-password", "", "Icinga2 API password")
+	icinga2Service = flag.String("icinga2-service", "", "Icinga2 service name (default: -submit-service)")
+	warnAsOK = flag.Bool("warn-as-ok", false, "Report WARNING conditions as OK.")
+	unknownAsCritical = flag.Bool("unknown-as-critical", false, "Report UNKNOWN conditions as CRITICAL.")
+	flag.Var(stateMapping, "map-state", "Override the state of a condition, e.g. lifecycle_warning=ok (repeatable, comma separated).\n"+
+		"Conditions: "+strings.Join(conditions, ", ")+", also stream:<id> and stream_alerts:<id>")
 
 	debug = os.Getenv(DEBUG)
-	perf(0, 0, 0, 0, 0, 0, 0, 0)
+	reset()
 }
 
 // return nagios codes on quit
 func quit(status int, message string, err error) {
-	var ev string
-
-	switch status {
-	case OK:
-		ev = "OK"
-	case WARNING:
-		ev = "WARNING"
-	case CRITICAL:
-		ev = "CRITICAL"
-	case UNKNOWN:
-		ev = "UNKNOWN"
-	}
-
 	// if debugging is enabled
 	// print errors
 	if len(debug) != 0 {
 		fmt.Println(err)
 	}
 
-	fmt.Printf("%s - %s|%s\n", ev, message, pdata)
+	print, ok := outputs[*output]
+	if !ok {
+		print = nagiosOutput
+	}
+	print(status, message, err)
 	os.Exit(status)
 }
 
+// stop on a usage or configuration error, the textfile output writes no
+// text so the message goes to stderr as well
+func invalid(message string, err error) {
+	if *output == "textfile" {
+		fmt.Fprintln(os.Stderr, summaryText(UNKNOWN, message))
+	}
+	quit(UNKNOWN, message, err)
+}
+
+// list of API URLs, repeatable and comma separated
+type urlList struct {
+	urls []string
+	// set once the default was replaced
+	set bool
+}
+
+// flag.Value interface
+func (u *urlList) String() string {
+	return strings.Join(u.urls, ",")
+}
+
+// flag.Value interface
+func (u *urlList) Set(value string) error {
+	if !u.set {
+		u.urls, u.set = nil, true
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			u.urls = append(u.urls, v)
+		}
+	}
+	return nil
+}
+
 // parse link
-func parse(link *string) string {
-	l, err := url.Parse(*link)
+func parse(link string) string {
+	s, err := parseURL(link)
 	if err != nil {
-		quit(UNKNOWN, "Can not parse given URL.", err)
+		invalid(err.Error(), err)
+	}
+	return s
+}
+
+// validate and normalize an API URL
+func parseURL(link string) (string, error) {
+	l, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("Can not parse given URL.")
+	}
+	host, port, err := net.SplitHostPort(l.Host)
+	if err != nil {
+		host, port = l.Hostname(), l.Port()
+		if *cloud {
+			// cloud tenants are addressed without port
+			port = "443"
+		}
 	}
-	host, port, _ := net.SplitHostPort(l.Host)
 
 	if len(host) == 0 {
-		quit(UNKNOWN, "Hostname is missing.", err)
+		return "", fmt.Errorf("Hostname is missing.")
 	}
 
 	if _, err := strconv.Atoi(port); err != nil {
-		quit(UNKNOWN, "Port is not a number.", err)
+		return "", fmt.Errorf("Port is not a number.")
 	}
 
 	if !strings.HasPrefix(l.Scheme, "HTTP") && !strings.HasPrefix(l.Scheme, "http") {
-		quit(UNKNOWN, "Only HTTP/S protocols are supported.", err)
+		return "", fmt.Errorf("Only HTTP/S protocols are supported.")
+	}
+
+	if *cloud && (l.Path == "" || l.Path == "/") {
+		l.Path = "/api"
 	}
 
 	s := l.String()
@@ -128,34 +350,211 @@ func parse(link *string) string {
 		s = s[0:len(s)-1]
 	}
 
-	return s
+	return s, nil
 }
 
 func main() {
-	flag.Parse()
+	args, err := extraOpts(os.Args[1:])
+	if err != nil {
+		invalid(fmt.Sprintf("Can not read --extra-opts: %v", err), err)
+	}
+	flag.CommandLine.Parse(args)
 
 	if *version {
 		fmt.Printf("Version: %v License: %v %v %v %v\n", id, license, copyright, year, author)
 		os.Exit(3)
 	}
 
-	if len(*user) == 0 || len(*pass) == 0 {
+	if _, ok := outputs[*output]; !ok {
+		quit(UNKNOWN, fmt.Sprintf("Unknown output format %q, use one of: %s", *output, formats()), nil)
+	}
+	if *mode != "full" && *mode != "quick" {
+		invalid(fmt.Sprintf("Unknown mode %q, use one of: full, quick", *mode), nil)
+	}
+	if *output == "textfile" && len(*textfileDir) == 0 {
+		*output = "nagios"
+		quit(UNKNOWN, "-output textfile requires -textfile-dir", nil)
+	}
+
+	if len(*targetsFile) > 0 {
+		if targets, err = loadTargets(*targetsFile); err != nil {
+			invalid(fmt.Sprintf("Can not read -targets-file: %v", err), err)
+		}
+	} else if (len(*user) == 0 || len(*pass) == 0) && len(*token) == 0 {
 		flag.PrintDefaults()
 		os.Exit(3)
 	}
+	if *cloud && *expectedNodes > 0 {
+		invalid("-expected-nodes is not available in Graylog Cloud.", nil)
+	}
+	if *tokenType != "token" && *tokenType != "bearer" {
+		invalid("-token-type must be token or bearer.", nil)
+	}
+
+	var c []string
+	if len(*discover) == 0 || links.set {
+		for _, link := range links.urls {
+			c = append(c, parse(link))
+		}
+	}
+	if len(*discover) > 0 && !strings.HasPrefix(*discover, "srv:") {
+		invalid("Only srv: discovery is supported.", nil)
+	}
+	if len(c) == 0 && len(*discover) == 0 {
+		invalid("Graylog2 API URL is missing.", nil)
+	}
+
+	if *daemon {
+		serve(c)
+	}
+
+	o := check(c)
+	submit(o.status, o.message)
+	quit(o.status, o.message, o.err)
+}
+
+// result of a complete run
+type outcome struct {
+	status  int
+	message string
+	err     error
+}
+
+// stop the current run, recovered by run
+func abort(status int, message string, err error) {
+	panic(outcome{status: status, message: message, err: err})
+}
+
+// reset per run state
+func reset() {
+	completed = false
+	downtimeHosts = nil
+	results = nil
+	details = nil
+	metrics = nil
+	clusterRuns = nil
+	labels := []string{"time", "total", "sources", "throughput", "index_failures", "collectors", "collector_failure", "collector_offline"}
+	if *cloud {
+		labels = labels[:5]
+	}
+	if *mode == "quick" {
+		labels = labels[:1]
+	}
+	for _, label := range labels {
+		perf(label, 0)
+	}
+}
+
+// resolve -discover SRV records to API endpoints, ordered by priority and weight
+func discovered() ([]string, error) {
+	_, srvs, err := net.LookupSRV("", "", strings.TrimPrefix(*discover, "srv:"))
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []string
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		endpoints = append(endpoints, fmt.Sprintf("%s://%s%s", *discoverScheme, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))), strings.TrimRight(*discoverPath, "/")))
+	}
+	return endpoints, nil
+}
+
+// run all checks against the first endpoint that answers
+func failover(static []string) outcome {
+	var o outcome
+	var failed []string
+
+	// discovered endpoints come first, static ones remain as fallback
+	endpoints := static
+	if len(*discover) > 0 {
+		srvs, err := discovered()
+		if err != nil && len(static) == 0 {
+			reset()
+			detail(err.Error())
+			return outcome{status: state("api", CRITICAL), message: "Can not discover Graylog2 API endpoints", err: err}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("API discovery failed: %v", err))
+		}
+		endpoints = append(srvs, static...)
+	}
+
+	var answered string
+	for _, c := range endpoints {
+		o = run(c)
+		if completed {
+			answered = c
+			break
+		}
+		failed = append(failed, fmt.Sprintf("API endpoint %s failed: %s", c, o.message))
+	}
+
+	if len(endpoints) == 0 {
+		reset()
+		return outcome{status: state("api", CRITICAL), message: fmt.Sprintf("No Graylog2 API endpoints found for %s", *discover)}
+	}
+	if len(endpoints) == 1 && len(*discover) == 0 {
+		return o
+	}
+	if !completed {
+		o.message = fmt.Sprintf("%s (all %d API endpoints failed)", o.message, len(endpoints))
+		detail(failed...)
+		return o
+	}
+
+	detail(failed...)
+	detail(fmt.Sprintf("API endpoint %s answered", answered))
+	return o
+}
+
+// run all checks against the API at c
+func run(c string) (o outcome) {
+	reset()
+	endpoint = c
+	defer func() {
+		if r := recover(); r != nil {
+			if f, ok := r.(outcome); ok {
+				o = f
+				return
+			}
+			// unexpected JSON structure, any other panic is a bug
+			if err, ok := r.(*runtime.TypeAssertionError); ok {
+				o = outcome{status: state("api", UNKNOWN), message: "Unexpected response from Graylog2 API", err: err}
+				return
+			}
+			panic(r)
+		}
+	}()
 
-	c := parse(link)
 	start := time.Now()
 
 	system := query(c+"/system", *user, *pass)
 	if system["is_processing"].(bool) != true {
-		quit(CRITICAL, "Service is not processing", nil)
+		report("processing", CRITICAL, "Service is not processing")
+	} else {
+		report("processing", OK, "Service is processing")
 	}
 	if strings.Compare(system["lifecycle"].(string), "running") != 0 {
-		quit(WARNING, fmt.Sprintf("lifecycle: %v", system["lifecycle"].(string)), nil)
+		report("lifecycle", WARNING, fmt.Sprintf("lifecycle: %v", system["lifecycle"].(string)))
+	} else {
+		report("lifecycle", OK, "lifecycle: running")
+	}
+	// lb_status is node local and not exposed by Graylog Cloud
+	if !*cloud {
+		if strings.Compare(system["lb_status"].(string), "alive") != 0 {
+			report("lb_status", WARNING, fmt.Sprintf("lb_status: %v", system["lb_status"].(string)))
+		} else {
+			report("lb_status", OK, "lb_status: alive")
+		}
 	}
-	if strings.Compare(system["lb_status"].(string), "alive") != 0 {
-		quit(WARNING, fmt.Sprintf("lb_status: %v", system["lb_status"].(string)), nil)
+
+	if *mode == "quick" {
+		elapsed := time.Since(start)
+		perf("time", elapsed.Seconds())
+		checkTime(elapsed)
+		detail(fmt.Sprintf("Check took %v", elapsed))
+		return done()
 	}
 
 	index := query(c+"/system/indexer/failures", *user, *pass)
@@ -163,62 +562,310 @@ func main() {
 	inputs := query(c+"/system/inputs", *user, *pass)
 	total := query(c+"/count/total", *user, *pass)
 
-	collectors := query(c+"/plugins/org.graylog.plugins.collector/collectors", *user, *pass)
+	if *expectedNodes > 0 && !*cloud {
+		checkNodes(query(c+"/cluster", *user, *pass))
+	}
+	if *leader && !*cloud {
+		checkLeader(query(c+"/system/cluster/nodes", *user, *pass))
+	}
+
+	if len(streams) > 0 {
+		checkStreams(c)
+	}
+	if *streamRouting {
+		checkRouting(c)
+	}
+	if *forwarders {
+		// the forwarder plugin needs Graylog 4 enterprise or cloud
+		if list, ok := optional("forwarders", c+"/plugins/org.graylog.plugins.forwarder/forwarder"); ok {
+			checkForwarders(list)
+		}
+	}
 
 	failures := 0
 	offline := 0
 	collectorCount:=0
-
-	for index := range collectors["collectors"].([]interface {}) {
-		collectorCount++
-		element := collectors["collectors"].([]interface{})[index].(map[string]interface{})
-
-		if !element["active"].(bool) {
-			offline++
-		} else {
-			status := element["node_details"].(map[string]interface{})["status"].(map[string]interface{})["status"].(float64)
-			// 0= Running, 1=Unknown, 2=Failing, default=Unknown
-			if (status > 0) {
-				failures++;
+	downtime := 0
+
+	// the collector plugin runs on the nodes and is not available in Graylog Cloud,
+	// sidecars replaced it in Graylog 3
+	collectorPlugin := !*cloud
+	var collectors map[string]interface{}
+	if collectorPlugin {
+		var f *apiFailure
+		collectors, f = fetch(c+"/plugins/org.graylog.plugins.collector/collectors", *user, *pass)
+		if f != nil && f.code == http.StatusNotFound {
+			collectorPlugin = false
+		} else if f != nil {
+			abort(f.status, f.message, f.err)
+		}
+	}
+	// names of the collectors behind the counts
+	var problems []string
+	if collectorPlugin {
+		for index := range collectors["collectors"].([]interface {}) {
+			collectorCount++
+			element := collectors["collectors"].([]interface{})[index].(map[string]interface{})
+
+			if !element["active"].(bool) {
+				if host, _ := element["node_id"].(string); inDowntime(host) {
+					downtime++
+					detail(fmt.Sprintf("collector %s is inactive during a scheduled downtime", host))
+					continue
+				}
+				offline++
+				problems = append(problems, fmt.Sprintf("collector %v is inactive", element["node_id"]))
+			} else {
+				nodeStatus := element["node_details"].(map[string]interface{})["status"].(map[string]interface{})
+				status := nodeStatus["status"].(float64)
+				// 0= Running, 1=Unknown, 2=Failing, default=Unknown
+				if (status > 0) {
+					failures++;
+					problem := fmt.Sprintf("collector %v is failing", element["node_id"])
+					if message, _ := nodeStatus["message"].(string); len(message) > 0 {
+						problem += ": " + message
+					}
+					problems = append(problems, problem)
+				}
 			}
 		}
 	}
 
 	elapsed := time.Since(start)
 
-	perf(elapsed.Seconds(), total["events"].(float64), inputs["total"].(float64), tput["throughput"].(float64), index["total"].(float64), float64(collectorCount), float64(failures), float64(offline))
+	perf("time", elapsed.Seconds())
+	perf("total", total["events"].(float64))
+	perf("sources", inputs["total"].(float64))
+	perf("throughput", tput["throughput"].(float64))
+	perf("index_failures", index["total"].(float64))
+	if collectorPlugin {
+		perf("collectors", float64(collectorCount))
+		perf("collector_failure", float64(failures))
+		perf("collector_offline", float64(offline))
+	}
+	if len(*downtimeSource) > 0 && collectorPlugin {
+		perf("collector_downtime", float64(downtime))
+	}
+
+	checkTime(elapsed)
 
-	if (failures + offline >= *collectorCT) {
-		if (failures > 0 && offline > 0) {
-			quit(CRITICAL, fmt.Sprintf("%d collectors are failing and %d are inactive", failures, offline), nil)
-		} else if (failures > 0) {
-			quit(CRITICAL, fmt.Sprintf("%d collectors are failing", failures), nil)
+	if !*cloud && !collectorPlugin {
+		if *expectedCollectors > 0 {
+			report("expected_collectors", CRITICAL, fmt.Sprintf("Expecting %d collectors but the collector plugin is not installed", *expectedCollectors))
+		}
+	}
+	if collectorPlugin {
+		if (failures + offline >= *collectorCT) {
+			report("collectors", CRITICAL, collectorMessage(failures, offline))
+		} else if (failures + offline >= *collectorWT) {
+			report("collectors", WARNING, collectorMessage(failures, offline))
 		} else {
-			quit(CRITICAL, fmt.Sprintf("%d collectors are inactive", offline), nil)
+			report("collectors", OK, collectorMessage(failures, offline))
+		}
+
+		if (*expectedCollectors > 0 && *expectedCollectors != collectorCount) {
+			report("expected_collectors", CRITICAL, fmt.Sprintf("Expecting %d collectors but %d reported in", *expectedCollectors, collectorCount))
+		} else if *expectedCollectors > 0 {
+			report("expected_collectors", OK, fmt.Sprintf("%d collectors reported in", collectorCount))
 		}
-	} else if (failures + offline >= *collectorWT) {
-		if (failures > 0 && offline > 0) {
-			quit(WARNING, fmt.Sprintf("%d collectors are failing and %d are inactive", failures, offline), nil)
-		} else if (failures > 0) {
-			quit(WARNING, fmt.Sprintf("%d collectors are failing", failures), nil)
+	}
+
+	detail(
+		fmt.Sprintf("%.f total events processed", total["events"].(float64)),
+		fmt.Sprintf("%.f index failures", index["total"].(float64)),
+		fmt.Sprintf("%.f throughput", tput["throughput"].(float64)),
+		fmt.Sprintf("%.f sources", inputs["total"].(float64)))
+	if collectorPlugin {
+		detail(
+			fmt.Sprintf("%d collectors detected", collectorCount),
+			fmt.Sprintf("%d collectors offline", offline),
+			fmt.Sprintf("%d collectors failing", failures))
+		sort.Strings(problems)
+		detail(problems...)
+	} else if !*cloud {
+		detail("Collector plugin is not installed")
+	}
+	detail(fmt.Sprintf("Check took %v", elapsed))
+
+	return done()
+}
+
+// evaluate -time-warn and -time-crit
+func checkTime(elapsed time.Duration) {
+	if *timeWT > 0 || *timeCT > 0 {
+		thresholds("time", seconds(*timeWT), seconds(*timeCT))
+
+		if *timeCT > 0 && elapsed >= *timeCT {
+			report("time", CRITICAL, fmt.Sprintf("Check took %v", elapsed))
+		} else if *timeWT > 0 && elapsed >= *timeWT {
+			report("time", WARNING, fmt.Sprintf("Check took %v", elapsed))
 		} else {
-			quit(WARNING, fmt.Sprintf("%d collectors are inactive", offline), nil)
+			report("time", OK, fmt.Sprintf("Check took %v", elapsed))
 		}
 	}
+}
 
-	if (*expectedCollectors > 0 && *expectedCollectors != collectorCount) {
-		quit(CRITICAL, fmt.Sprintf("Expecting %d collectors but %d reported in", *expectedCollectors, collectorCount), nil)
+// outcome of a completed run
+func done() outcome {
+	completed = true
+	if status, message := summary(); status != OK {
+		return outcome{status: status, message: message}
 	}
 
-	quit(OK, fmt.Sprintf("Service is running!\n%.f total events processed\n%.f index failures\n%.f throughput\n%.f sources\n%.f collectors detected\n%.f collectors offline\n%.f collectors failing\nCheck took %v",
-		total["events"].(float64), index["total"].(float64), tput["throughput"].(float64), inputs["total"].(float64), float64(collectorCount), float64(offline), float64(failures), elapsed), nil)
+	return outcome{status: OK, message: "Service is running!"}
 }
 
-// call Graylog2 HTTP API
+// format a threshold for performance data, empty if unset
+func seconds(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// describe collector problems
+func collectorMessage(failures, offline int) string {
+	if (failures > 0 && offline > 0) {
+		return fmt.Sprintf("%d collectors are failing and %d are inactive", failures, offline)
+	} else if (failures > 0) {
+		return fmt.Sprintf("%d collectors are failing", failures)
+	} else if (offline > 0) {
+		return fmt.Sprintf("%d collectors are inactive", offline)
+	}
+	return "all collectors are running"
+}
+
+// compare the active nodes of /cluster against -expected-nodes
+func checkNodes(cluster map[string]interface{}) {
+	var active, inactive []string
+	// start time of the active nodes, to tell which joined last
+	started := map[string]string{}
+
+	for id, v := range cluster {
+		node, ok := v.(map[string]interface{})
+		if !ok {
+			// the node did not answer the cluster request
+			inactive = append(inactive, fmt.Sprintf("node %v is not responding", id))
+			continue
+		}
+		if lifecycle, _ := node["lifecycle"].(string); lifecycle != "" && lifecycle != "running" {
+			inactive = append(inactive, fmt.Sprintf("node %v (%v) is %v", id, node["hostname"], lifecycle))
+			continue
+		}
+		line := fmt.Sprintf("node %v (%v) is active", id, node["hostname"])
+		active = append(active, line)
+		started[line], _ = node["started_at"].(string)
+	}
+	sort.Strings(active)
+	sort.Strings(inactive)
+
+	perf("nodes", float64(len(active)))
+
+	switch {
+	case len(active) < *expectedNodes:
+		report("expected_nodes", CRITICAL, fmt.Sprintf("Expecting %d nodes but %d are active", *expectedNodes, len(active)))
+		if len(inactive) == 0 {
+			// missing nodes are unknown to the cluster, show who is left
+			detail(active...)
+		}
+		detail(inactive...)
+	case len(active) > *expectedNodes:
+		report("expected_nodes", CRITICAL, fmt.Sprintf("Expecting %d nodes but %d are active", *expectedNodes, len(active)))
+		// the nodes started last are the ones beyond the expected count
+		sort.SliceStable(active, func(i, j int) bool { return started[active[i]] < started[active[j]] })
+		for _, line := range active[*expectedNodes:] {
+			if started[line] != "" {
+				line += " since " + started[line]
+			}
+			detail(line)
+		}
+	default:
+		report("expected_nodes", OK, fmt.Sprintf("%d nodes are active", len(active)))
+	}
+}
+
+// verify exactly one node of /system/cluster/nodes is the leader
+func checkLeader(cluster map[string]interface{}) {
+	var leaders []string
+
+	nodes, _ := cluster["nodes"].([]interface{})
+	for _, v := range nodes {
+		node, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// Graylog 4 renamed is_master to is_leader
+		isLeader, _ := node["is_leader"].(bool)
+		isMaster, _ := node["is_master"].(bool)
+		if isLeader || isMaster {
+			leaders = append(leaders, fmt.Sprintf("node %v (%v) is leader", node["node_id"], node["hostname"]))
+		}
+	}
+	sort.Strings(leaders)
+
+	perf("leaders", float64(len(leaders)))
+
+	switch len(leaders) {
+	case 0:
+		report("leader", CRITICAL, "No leader node in cluster")
+	case 1:
+		report("leader", OK, "One leader node in cluster")
+	default:
+		report("leader", CRITICAL, fmt.Sprintf("%d leader nodes in cluster", len(leaders)))
+		detail(leaders...)
+	}
+}
+
+// credentials of API requests, an access token replaces username and password
+func credentials(user, pass string) (string, string) {
+	if len(*token) > 0 {
+		return *token, "token"
+	}
+	return user, pass
+}
+
+// call Graylog2 HTTP API, stopping the run on any failure
 func query(target string, user string, pass string) map[string]interface{} {
+	data, f := fetch(target, user, pass)
+	if f != nil {
+		abort(f.status, f.message, f.err)
+	}
+	return data
+}
+
+// query the endpoint of an optional sub-check, an error reply of the API is
+// reported under condition instead of stopping the run
+func optional(condition string, target string) (map[string]interface{}, bool) {
+	data, f := fetch(target, *user, *pass)
+	if f == nil {
+		return data, true
+	}
+	if f.code == 0 {
+		abort(f.status, f.message, f.err)
+	}
+	report(condition, UNKNOWN, f.message)
+	return nil, false
+}
+
+// failed API request
+type apiFailure struct {
+	status  int
+	message string
+	err     error
+	// HTTP status code, 0 when the API did not reply
+	code int
+}
+
+// call Graylog2 HTTP API
+func fetch(target string, user string, pass string) (map[string]interface{}, *apiFailure) {
 	var client *http.Client
 	var data map[string]interface{}
 
+	user, pass = credentials(user, pass)
+	if body, ok := cached(target, user, pass); ok && json.Unmarshal(body, &data) == nil {
+		return data, nil
+	}
+
 	if *ssl {
 		tp := &http.Transport{
 			// keep this necessary evil for internal servers with custom certs?
@@ -230,32 +877,51 @@ func query(target string, user string, pass string) map[string]interface{} {
 		client = &http.Client{}
 	}
 
+	// a hanging API must not stall the exporter loop
+	client.Timeout = *timeout
+	if *daemon && *timeout == 0 {
+		client.Timeout = *interval
+	}
+	if *mode == "quick" && *timeout == 0 {
+		client.Timeout = quickTimeout
+	}
+
 	req, err := http.NewRequest("GET", target, nil)
-	req.SetBasicAuth(user, pass)
+	if err != nil {
+		return nil, &apiFailure{status: state("api", UNKNOWN), message: "Can not create Graylog2 API request", err: err}
+	}
+	if len(*token) > 0 && *tokenType == "bearer" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	} else {
+		req.SetBasicAuth(user, pass)
+	}
+	req.Header.Set("Accept", "application/json")
 
 	res, err := client.Do(req)
 	if err != nil {
-		quit(CRITICAL, "Can not connect to Graylog2 API", err)
+		return nil, &apiFailure{status: state("api", CRITICAL), message: "Can not connect to Graylog2 API", err: err}
 	}
 	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		quit(CRITICAL, "No response received from Graylog2 API", err)
+		return nil, &apiFailure{status: state("api", CRITICAL), message: "No response received from Graylog2 API", err: err}
 	}
 
 	if len(debug) != 0 {
 		fmt.Println(string(body))
 	}
 
-	err = json.Unmarshal(body, &data)
-	if err != nil {
-		quit(UNKNOWN, "Can not parse JSON from Graylog2 API", err)
+	// error replies are not always JSON
+	if res.StatusCode != 200 {
+		return nil, &apiFailure{status: state("api", CRITICAL), message: fmt.Sprintf("Graylog2 API replied with HTTP code %v for %s", res.StatusCode, req.URL.Path), code: res.StatusCode}
 	}
 
-	if res.StatusCode != 200 {
-		quit(CRITICAL, fmt.Sprintf("Graylog2 API replied with HTTP code %v", res.StatusCode), err)
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, &apiFailure{status: state("api", UNKNOWN), message: fmt.Sprintf("Can not parse JSON from Graylog2 API for %s", req.URL.Path), err: err}
 	}
 
-	return data
+	store(target, user, pass, body)
+	return data, nil
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunUnexpectedResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"is_processing": "yes", "lifecycle": "running", "lb_status": "alive"}`))
+	}))
+	defer ts.Close()
+
+	o := run(ts.URL)
+	if o.status != UNKNOWN || o.message != "Unexpected response from Graylog2 API" {
+		t.Errorf("got %s %q, want UNKNOWN for a mistyped field", stateName(o.status), o.message)
+	}
+	if completed {
+		t.Error("run completed despite the unexpected response")
+	}
+}
+
+func TestRunHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"type": "ApiError", "message": "unavailable"}`))
+	}))
+	defer ts.Close()
+
+	o := run(ts.URL)
+	if o.status != CRITICAL || o.message != "Graylog2 API replied with HTTP code 503 for /system" {
+		t.Errorf("got %s %q", stateName(o.status), o.message)
+	}
+}
+
+// canned replies of a Graylog 2 node by path, 404 for anything else
+func graylogFixture(t *testing.T, replies map[string]string) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := replies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// replies of the endpoints every full check needs
+func coreReplies() map[string]string {
+	return map[string]string{
+		"/system":                  `{"is_processing": true, "lifecycle": "running", "lb_status": "alive"}`,
+		"/system/indexer/failures": `{"total": 0}`,
+		"/system/throughput":       `{"throughput": 10}`,
+		"/system/inputs":           `{"total": 1}`,
+		"/count/total":             `{"events": 100}`,
+		"/plugins/org.graylog.plugins.collector/collectors": `{"collectors": []}`,
+	}
+}
+
+// result of a condition in the last run
+func resultOf(condition string) (result, bool) {
+	for _, r := range results {
+		if r.name == condition {
+			return r, true
+		}
+	}
+	return result{}, false
+}
+
+func TestRunOptionalEndpointMissing(t *testing.T) {
+	setFlag(t, "forwarders", "true")
+	ts := graylogFixture(t, coreReplies())
+
+	o := run(ts.URL)
+	if !completed || o.status != UNKNOWN {
+		t.Fatalf("got %s %q, want a completed run with UNKNOWN forwarders", stateName(o.status), o.message)
+	}
+	r, ok := resultOf("forwarders")
+	if !ok || r.status != UNKNOWN || !strings.Contains(r.message, "HTTP code 404 for /plugins/org.graylog.plugins.forwarder/forwarder") {
+		t.Errorf("forwarders result %+v", r)
+	}
+	if r, ok := resultOf("processing"); !ok || r.status != OK {
+		t.Errorf("results gathered before the missing endpoint were lost: %+v", results)
+	}
+}
+
+func TestRunWithoutCollectorPlugin(t *testing.T) {
+	replies := coreReplies()
+	delete(replies, "/plugins/org.graylog.plugins.collector/collectors")
+	ts := graylogFixture(t, replies)
+
+	if o := run(ts.URL); o.status != OK || !completed {
+		t.Fatalf("got %s %q, want OK without the collector plugin", stateName(o.status), o.message)
+	}
+	if _, ok := resultOf("collectors"); ok {
+		t.Error("collectors reported without the collector plugin")
+	}
+	if !contains(details, "Collector plugin is not installed") {
+		t.Errorf("missing plugin not noted in %q", details)
+	}
+
+	setFlag(t, "ex", "2")
+	if o := run(ts.URL); o.status != CRITICAL {
+		t.Errorf("got %s %q, want CRITICAL when collectors are expected", stateName(o.status), o.message)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		link  string
+		cloud bool
+		want  string
+		err   string
+	}{
+		{link: "http://graylog:9000/api/", want: "http://graylog:9000/api"},
+		{link: "HTTPS://graylog:443", want: "https://graylog:443"},
+		{link: "http://graylog/api", err: "Port is not a number."},
+		{link: "http://:9000/api", err: "Hostname is missing."},
+		{link: "ftp://graylog:21", err: "Only HTTP/S protocols are supported."},
+		{link: "http://graylog:port", err: "Can not parse given URL."},
+		{link: "https://tenant.graylog.cloud", cloud: true, want: "https://tenant.graylog.cloud/api"},
+		{link: "https://tenant.graylog.cloud/", cloud: true, want: "https://tenant.graylog.cloud/api"},
+		{link: "https://tenant.graylog.cloud/custom/api/", cloud: true, want: "https://tenant.graylog.cloud/custom/api"},
+		{link: "https://tenant.graylog.cloud:8443", cloud: true, want: "https://tenant.graylog.cloud:8443/api"},
+		{link: "https:///api", cloud: true, err: "Hostname is missing."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			setFlag(t, "cloud", strconv.FormatBool(tt.cloud))
+			got, err := parseURL(tt.link)
+			if len(tt.err) > 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCollectorDetails(t *testing.T) {
+	replies := coreReplies()
+	replies["/plugins/org.graylog.plugins.collector/collectors"] = `{"collectors": [
+		{"node_id": "web01", "active": true, "node_details": {"status": {"status": 0, "message": ""}}},
+		{"node_id": "web03", "active": true, "node_details": {"status": {"status": 2, "message": "filebeat: exit status 1"}}},
+		{"node_id": "web02", "active": false, "node_details": {"status": {"status": 0}}},
+		{"node_id": "web04", "active": true, "node_details": {"status": {"status": 1}}}
+	]}`
+	ts := graylogFixture(t, replies)
+	setFlag(t, "ct", "4")
+
+	if o := run(ts.URL); o.status != WARNING || o.message != "2 collectors are failing and 1 are inactive" {
+		t.Fatalf("got %s %q", stateName(o.status), o.message)
+	}
+	for _, want := range []string{
+		"collector web02 is inactive",
+		"collector web03 is failing: filebeat: exit status 1",
+		"collector web04 is failing",
+	} {
+		if !contains(details, want) {
+			t.Errorf("missing %q in %q", want, details)
+		}
+	}
+	for _, d := range details {
+		if strings.Contains(d, "web01") {
+			t.Errorf("running collector listed: %q", d)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// decoded reply of a cluster endpoint
+func clusterReply(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCheckNodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		body     string
+		status   int
+		message  string
+		details  []string
+	}{
+		{
+			name:     "all active",
+			expected: "2",
+			body:     `{"a": {"hostname": "gl1", "lifecycle": "running"}, "b": {"hostname": "gl2", "lifecycle": "running"}}`,
+			status:   OK,
+			message:  "2 nodes are active",
+		},
+		{
+			name:     "missing node with a null entry",
+			expected: "2",
+			body:     `{"a": {"hostname": "gl1", "lifecycle": "running"}, "b": null}`,
+			status:   CRITICAL,
+			message:  "Expecting 2 nodes but 1 are active",
+			details:  []string{"node b is not responding"},
+		},
+		{
+			name:     "node unknown to the cluster",
+			expected: "3",
+			body:     `{"a": {"hostname": "gl1", "lifecycle": "running"}, "b": {"hostname": "gl2", "lifecycle": "running"}}`,
+			status:   CRITICAL,
+			message:  "Expecting 3 nodes but 2 are active",
+			details:  []string{"node a (gl1) is active", "node b (gl2) is active"},
+		},
+		{
+			name:     "not running lifecycle",
+			expected: "2",
+			body:     `{"a": {"hostname": "gl1", "lifecycle": "running"}, "b": {"hostname": "gl2", "lifecycle": "halting"}}`,
+			status:   CRITICAL,
+			message:  "Expecting 2 nodes but 1 are active",
+			details:  []string{"node b (gl2) is halting"},
+		},
+		{
+			name:     "extra node",
+			expected: "2",
+			body: `{"a": {"hostname": "gl1", "lifecycle": "running", "started_at": "2026-10-01T08:00:00.000Z"},
+				"b": {"hostname": "gl2", "lifecycle": "running", "started_at": "2026-10-14T09:30:00.000Z"},
+				"c": {"hostname": "gl3", "lifecycle": "running", "started_at": "2026-10-01T08:05:00.000Z"}}`,
+			status:  CRITICAL,
+			message: "Expecting 2 nodes but 3 are active",
+			details: []string{"node b (gl2) is active since 2026-10-14T09:30:00.000Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "expected-nodes", tt.expected)
+			reset()
+			checkNodes(clusterReply(t, tt.body))
+
+			r, _ := resultOf("expected_nodes")
+			if r.status != tt.status || r.message != tt.message {
+				t.Errorf("got %s %q, want %s %q", stateName(r.status), r.message, stateName(tt.status), tt.message)
+			}
+			if !reflect.DeepEqual(details, tt.details) {
+				t.Errorf("details %q, want %q", details, tt.details)
+			}
+		})
+	}
+}
+
+func TestCheckLeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		message string
+		details []string
+	}{
+		{
+			name:    "no leader",
+			body:    `{"nodes": [{"node_id": "a", "hostname": "gl1", "is_master": false}, {"node_id": "b", "hostname": "gl2", "is_leader": false}]}`,
+			status:  CRITICAL,
+			message: "No leader node in cluster",
+		},
+		{
+			name:    "is_master",
+			body:    `{"nodes": [{"node_id": "a", "hostname": "gl1", "is_master": true}, {"node_id": "b", "hostname": "gl2", "is_master": false}]}`,
+			status:  OK,
+			message: "One leader node in cluster",
+		},
+		{
+			name:    "is_leader",
+			body:    `{"nodes": [{"node_id": "a", "hostname": "gl1", "is_master": false, "is_leader": true}, {"node_id": "b", "hostname": "gl2", "is_leader": false}]}`,
+			status:  OK,
+			message: "One leader node in cluster",
+		},
+		{
+			name:    "two leaders",
+			body:    `{"nodes": [{"node_id": "b", "hostname": "gl2", "is_leader": true}, {"node_id": "a", "hostname": "gl1", "is_master": true}, "bogus"]}`,
+			status:  CRITICAL,
+			message: "2 leader nodes in cluster",
+			details: []string{"node a (gl1) is leader", "node b (gl2) is leader"},
+		},
+		{
+			name:    "no nodes",
+			body:    `{}`,
+			status:  CRITICAL,
+			message: "No leader node in cluster",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			checkLeader(clusterReply(t, tt.body))
+
+			r, _ := resultOf("leader")
+			if r.status != tt.status || r.message != tt.message {
+				t.Errorf("got %s %q, want %s %q", stateName(r.status), r.message, stateName(tt.status), tt.message)
+			}
+			if !reflect.DeepEqual(details, tt.details) {
+				t.Errorf("details %q, want %q", details, tt.details)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// status message bytes kept before performance data is dropped
+const minText = 64
+
+// output formats selectable with -output
+var outputs = map[string]func(status int, message string, err error){
+	"nagios":   nagiosOutput,
+	"json":     jsonOutput,
+	"checkmk":  checkmkOutput,
+	"zabbix":   zabbixOutput,
+	"sensu":    sensuOutput,
+	"textfile": textfileOutput,
+}
+
+// list of output format names
+func formats() string {
+	var names []string
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// nagios plugin output
+func nagiosOutput(status int, message string, err error) {
+	fmt.Println(nagiosText(status, message, *maxOutput))
+}
+
+// nagios plugin output text limited to max bytes, also used for passive results
+//
+// The summary and performance data make up the first line, long output
+// follows on the next lines as described by the plugin API.
+func nagiosText(status int, message string, max int) string {
+	head, perf, long := summaryText(status, message), pdata(), strings.Join(longOutput(), "\n")
+	text := head + "|" + perf
+	if max <= 0 || len(text)+1+len(long) <= max {
+		if len(long) > 0 {
+			text += "\n" + long
+		}
+		return text
+	}
+
+	// long output is cut first
+	const more = "\n(output truncated)"
+	if n := max - len(text) - len(more); n > 1 && len(long) > 0 {
+		kept := cut(long, n-1)
+		// keep complete lines only
+		if long[len(kept)] != '\n' {
+			if i := strings.LastIndex(kept, "\n"); i >= 0 {
+				kept = kept[:i]
+			} else {
+				kept = ""
+			}
+		}
+		if len(kept) == 0 {
+			return text + more
+		}
+		return text + "\n" + kept + more
+	}
+
+	const note = " (truncated)"
+	if max <= len(note)+minText {
+		// no room for anything but the start of the status message
+		return cut(head, max)
+	}
+
+	// keep whole performance data values, dropping the last ones only if
+	// they leave no room for the status message
+	values := strings.Fields(perf)
+	for len(values) > 0 && max-len(strings.Join(values, " "))-1-len(note) < minText {
+		values = values[:len(values)-1]
+	}
+	perf = strings.Join(values, " ")
+
+	n := max - len(note)
+	if len(perf) > 0 {
+		n -= len(perf) + 1
+	}
+	head = cut(head, n) + note
+
+	if len(perf) == 0 {
+		return head
+	}
+	return head + "|" + perf
+}
+
+// shorten s to at most n bytes without splitting multi byte characters
+func cut(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// first output line without performance data
+func summaryText(status int, message string) string {
+	return fmt.Sprintf("%s - %s", stateName(status), sanitize(message))
+}
+
+// long output lines safe for plugin output
+func longOutput() []string {
+	lines := make([]string, len(details))
+	for i, d := range details {
+		lines[i] = sanitize(d)
+	}
+	return lines
+}
+
+// status message and long output without performance data
+func plainText(status int, message string) string {
+	if len(details) > 0 {
+		return summaryText(status, message) + "\n" + strings.Join(longOutput(), "\n")
+	}
+	return summaryText(status, message)
+}
+
+// structured output for post-processing
+func jsonOutput(status int, message string, err error) {
+	type jsonCheck struct {
+		Name    string `json:"name"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	type jsonMetric struct {
+		Label string  `json:"label"`
+		Value float64 `json:"value"`
+		Warn  string  `json:"warn,omitempty"`
+		Crit  string  `json:"crit,omitempty"`
+	}
+	out := struct {
+		Status   string       `json:"status"`
+		ExitCode int          `json:"exit_code"`
+		Message  string       `json:"message"`
+		Error    string       `json:"error,omitempty"`
+		Checks   []jsonCheck  `json:"checks"`
+		Metrics  []jsonMetric `json:"metrics"`
+		Details  []string     `json:"details,omitempty"`
+	}{
+		Status:   stateName(status),
+		ExitCode: status,
+		Message:  message,
+		Checks:   []jsonCheck{},
+		Metrics:  []jsonMetric{},
+		Details:  details,
+	}
+
+	if err != nil {
+		out.Error = err.Error()
+	}
+	for _, r := range results {
+		out.Checks = append(out.Checks, jsonCheck{Name: r.name, Status: stateName(r.status), Message: r.message})
+	}
+	for _, m := range metrics {
+		out.Metrics = append(out.Metrics, jsonMetric{Label: m.label, Value: m.value, Warn: m.warn, Crit: m.crit})
+	}
+
+	json.NewEncoder(os.Stdout).Encode(out)
+}
+
+// CheckMK local check lines, one per sub-check plus the overall service carrying the performance data
+func checkmkOutput(status int, message string, err error) {
+	var perfdata []string
+	for _, m := range metrics {
+		perfdata = append(perfdata, m.String())
+	}
+
+	// long output is separated by a literal \n in local checks
+	lines := append([]string{sanitize(message)}, longOutput()...)
+	fmt.Printf("%d Graylog %s %s\n", status, strings.Join(perfdata, "|"), strings.Join(lines, "\\n"))
+
+	for _, r := range results {
+		fmt.Printf("%d Graylog_%s - %s\n", r.status, r.name, sanitize(r.message))
+	}
+}
+
+// Sensu Go output for output_metric_format influxdb_line, the summary line is skipped by the metric parser
+func sensuOutput(status int, message string, err error) {
+	fmt.Println(summaryText(status, message))
+
+	if len(clusterRuns) > 0 {
+		// one set of points per -targets-file cluster, tagged with its name
+		fmt.Printf("graylog_status status=%d\n", status)
+		for _, r := range clusterRuns {
+			sensuPoints(",cluster="+influxEscape(r.name), r.status, r.metrics, r.results)
+		}
+		return
+	}
+
+	cluster := strings.TrimPrefix(*discover, "srv:")
+	if u, err := url.Parse(endpoint); err == nil && len(cluster) == 0 {
+		cluster = u.Host
+	}
+	// influx rejects empty tag values
+	tags := ""
+	if len(cluster) > 0 {
+		tags = ",cluster=" + influxEscape(cluster)
+	}
+	sensuPoints(tags, status, metrics, results)
+}
+
+// influx line protocol points of a cluster
+func sensuPoints(tags string, status int, metrics []metric, results []result) {
+	var fields []string
+	for _, m := range metrics {
+		fields = append(fields, influxEscape(m.label)+"="+strconv.FormatFloat(m.value, 'f', -1, 64))
+	}
+	// a point needs at least one field
+	if len(fields) > 0 {
+		fmt.Printf("graylog%s %s\n", tags, strings.Join(fields, ","))
+	}
+
+	fmt.Printf("graylog_status%s status=%d\n", tags, status)
+	for _, r := range results {
+		fmt.Printf("graylog_check%s,check=%s status=%d\n", tags, influxEscape(r.name), r.status)
+	}
+}
+
+// escape influx line protocol tag keys, values and field keys
+func influxEscape(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// per run state of a typical check
+func outputFixture() {
+	metrics = nil
+	for _, label := range []string{"time", "total", "sources", "throughput", "index_failures", "collectors"} {
+		perf(label, 768764376)
+	}
+	details = []string{
+		"768764376 total events processed",
+		"0 index failures",
+		"297 throughput",
+		"collector wébserver is inactive",
+		"Check took 94.123456µs",
+	}
+}
+
+func TestNagiosTextUnlimited(t *testing.T) {
+	outputFixture()
+	want := "OK - Service is running!|" + pdata() + "\n" + strings.Join(details, "\n")
+	if got := nagiosText(OK, "Service is running!", 0); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := nagiosText(OK, "Service is running!", len(want)); got != want {
+		t.Errorf("exact fit was changed to %q", got)
+	}
+}
+
+func TestNagiosTextCompleteLines(t *testing.T) {
+	outputFixture()
+	head := "OK - Service is running!|" + pdata()
+	more := "\n(output truncated)"
+
+	tests := []struct {
+		name string
+		max  int
+		want string
+	}{
+		{"one byte short", len(head) + 1 + len(strings.Join(details, "\n")) - 1, head + "\n" + strings.Join(details[:4], "\n") + more},
+		{"four lines", len(head) + 1 + len(strings.Join(details[:4], "\n")) + len(more), head + "\n" + strings.Join(details[:4], "\n") + more},
+		{"line boundary", len(head) + 1 + len(details[0]) + len(more), head + "\n" + details[0] + more},
+		{"partial first line", len(head) + 1 + len(details[0]) - 1 + len(more), head + more},
+		{"half of the first line", len(head) + 10 + len(more), head + more},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nagiosText(OK, "Service is running!", tt.max); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNagiosTextPerformanceData(t *testing.T) {
+	outputFixture()
+	got := nagiosText(CRITICAL, strings.Repeat("collector failing, ", 10), 200)
+
+	if strings.Contains(got, "\n") {
+		t.Errorf("long output kept in %q", got)
+	}
+	parts := strings.SplitN(got, "|", 2)
+	if !strings.HasSuffix(parts[0], " (truncated)") {
+		t.Errorf("status message not marked as truncated: %q", parts[0])
+	}
+	if len(parts) == 2 {
+		for _, v := range strings.Fields(parts[1]) {
+			if !strings.Contains(" "+pdata()+" ", " "+v+" ") {
+				t.Errorf("performance data value %q was cut", v)
+			}
+		}
+	}
+}
+
+func TestNagiosTextBoundaries(t *testing.T) {
+	outputFixture()
+	full := nagiosText(UNKNOWN, "Can not connect to Graylog2 API", 0)
+
+	for max := 1; max <= len(full); max++ {
+		got := nagiosText(UNKNOWN, "Can not connect to Graylog2 API", max)
+		if len(got) > max {
+			t.Fatalf("max %d: %d bytes returned", max, len(got))
+		}
+		if !utf8.ValidString(got) {
+			t.Fatalf("max %d: invalid UTF-8 in %q", max, got)
+		}
+
+		lines := strings.Split(got, "\n")
+		for _, line := range lines[1:] {
+			if line != "(output truncated)" && !contains(details, line) {
+				t.Fatalf("max %d: partial long output line %q", max, line)
+			}
+		}
+	}
+}
+
+func TestCut(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"abc", 5, "abc"},
+		{"abc", 2, "ab"},
+		{"aµb", 2, "a"},
+		{"aµb", 3, "aµ"},
+		{"µ", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := cut(tt.s, tt.n); got != tt.want {
+			t.Errorf("cut(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+// whether list holds s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// standard output of f
+func stdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = previous
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestSensuOutputPerCluster(t *testing.T) {
+	healthy := graylogFixture(t, coreReplies())
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	previous := targets
+	t.Cleanup(func() { targets = previous; reset() })
+	targets = []target{{name: "customer a", urls: []string{healthy.URL}}, {name: "b", urls: []string{failing.URL}}}
+
+	o := batch(nil)
+	out := stdout(t, func() { sensuOutput(o.status, o.message, o.err) })
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+
+	for _, want := range []string{
+		"graylog_status status=2",
+		"graylog_status,cluster=customer\\ a status=0",
+		"graylog_check,cluster=customer\\ a,check=processing status=0",
+		"graylog_status,cluster=b status=2",
+	} {
+		if !contains(lines, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	points := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "graylog,") {
+			points++
+			if !strings.HasPrefix(line, "graylog,cluster=customer\\ a time=") {
+				t.Errorf("unexpected point %q", line)
+			}
+			if strings.Contains(line, "customer_a_") {
+				t.Errorf("cluster prefix in field keys %q", line)
+			}
+		}
+	}
+	if points != 1 {
+		t.Errorf("%d graylog points, want one for the healthy cluster only:\n%s", points, out)
+	}
+	if strings.Contains(out, "127.0.0.1") {
+		t.Errorf("address tags in batch mode:\n%s", out)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTP client for the monitoring core, -insecure applies here as well
+func coreClient() *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if *ssl {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return client
+}
+
+// host name given by a flag, this host by default
+func thisHost(name string) string {
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return name
+}
+
+// send the result as passive check to the -submit receiver
+func passiveSubmit(status int, message string) error {
+	if *submitURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(*submitURL)
+	if err != nil {
+		return fmt.Errorf("Can not parse submit URL: %v", err)
+	}
+
+	host := thisHost(*submitHost)
+
+	switch strings.ToLower(u.Scheme) {
+	case "nsca":
+		// nsca writes the result as a single external command line, leave room for escaping newlines
+		max := *nscaOutputLength - 1 - strings.Count(plainText(status, message), "\n")
+		output := strings.Replace(nagiosText(status, message, max), "\n", `\n`, -1)
+		return nscaSubmit(u.Host, host, status, output)
+	case "http", "https":
+		return nrdpSubmit(u.String(), host, status, nagiosText(status, message, 0))
+	}
+	return fmt.Errorf("Only nsca:// and HTTP/S NRDP receivers are supported")
+}
+
+// send a passive check result using the NSCA protocol version 3
+func nscaSubmit(address, host string, status int, output string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "5667")
+	}
+
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("Can not connect to NSCA: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// initialization vector and server timestamp
+	hello := make([]byte, 132)
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		return fmt.Errorf("No initialization packet received from NSCA: %v", err)
+	}
+	packet, err := nscaPacket(hello[:128], binary.BigEndian.Uint32(hello[128:]), host, status, output)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(packet); err != nil {
+		return fmt.Errorf("Can not send to NSCA: %v", err)
+	}
+	return nil
+}
+
+// encrypted NSCA data packet for the initialization vector and timestamp of the server
+func nscaPacket(iv []byte, timestamp uint32, host string, status int, output string) ([]byte, error) {
+	// struct data_packet of nsca, padded to 4 bytes
+	size := 2 + 2 + 4 + 4 + 2 + 64 + 128 + *nscaOutputLength
+	size += (4 - size%4) % 4
+	packet := make([]byte, size)
+
+	binary.BigEndian.PutUint16(packet[0:], 3)
+	binary.BigEndian.PutUint32(packet[8:], timestamp)
+	binary.BigEndian.PutUint16(packet[12:], uint16(status))
+	cstring(packet[14:14+64], host)
+	cstring(packet[78:78+128], *submitService)
+	cstring(packet[206:206+*nscaOutputLength], output)
+	binary.BigEndian.PutUint32(packet[4:], crc32.ChecksumIEEE(packet))
+
+	switch *nscaEncryption {
+	case "none":
+	case "xor":
+		for i := range packet {
+			packet[i] ^= iv[i%len(iv)]
+		}
+		if key := []byte(*nscaPassword); len(key) > 0 {
+			for i := range packet {
+				packet[i] ^= key[i%len(key)]
+			}
+		}
+	default:
+		return nil, fmt.Errorf("NSCA encryption %q is not supported, use none or xor", *nscaEncryption)
+	}
+	return packet, nil
+}
+
+// copy a null terminated string into a fixed size field
+func cstring(field []byte, s string) {
+	copy(field[:len(field)-1], s)
+}
+
+// send a passive check result to the NRDP API
+func nrdpSubmit(target, host string, status int, output string) error {
+	type checkresult struct {
+		Type        string `xml:"type,attr"`
+		Checktype   string `xml:"checktype,attr"`
+		Hostname    string `xml:"hostname"`
+		Servicename string `xml:"servicename"`
+		State       int    `xml:"state"`
+		Output      string `xml:"output"`
+	}
+	data, err := xml.Marshal(struct {
+		XMLName xml.Name      `xml:"checkresults"`
+		Results []checkresult `xml:"checkresult"`
+	}{Results: []checkresult{{"service", "1", host, *submitService, status, output}}})
+	if err != nil {
+		return err
+	}
+
+	res, err := coreClient().PostForm(target, url.Values{
+		"token":   {*nrdpToken},
+		"cmd":     {"submitcheck"},
+		"XMLDATA": {xml.Header + string(data)},
+	})
+	if err != nil {
+		return fmt.Errorf("Can not connect to NRDP: %v", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("No response received from NRDP: %v", err)
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("NRDP replied with HTTP code %v", res.StatusCode)
+	}
+
+	var reply struct {
+		Status  int    `xml:"status"`
+		Message string `xml:"message"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&reply); err != nil {
+		return fmt.Errorf("Can not parse NRDP response: %v", err)
+	}
+	if reply.Status != 0 {
+		return fmt.Errorf("NRDP replied with status %d: %s", reply.Status, reply.Message)
+	}
+
+	return nil
+}
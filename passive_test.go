@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"hash/crc32"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// set a flag for the duration of a test
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	previous := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.Set(name, previous) })
+}
+
+// null terminated string of a fixed size field
+func field(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
+
+func TestNscaPacketLayout(t *testing.T) {
+	setFlag(t, "submit-service", "Graylog")
+	iv := bytes.Repeat([]byte{0xaa}, 128)
+
+	packet, err := nscaPacket(iv, 1500000000, "graylog01", WARNING, "WARNING - lb_status: throttled")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2+2+4+4+2+64+128+512 bytes padded to 4
+	if len(packet) != 720 {
+		t.Fatalf("packet has %d bytes, want 720", len(packet))
+	}
+	if v := binary.BigEndian.Uint16(packet[0:]); v != 3 {
+		t.Errorf("version %d, want 3", v)
+	}
+	if ts := binary.BigEndian.Uint32(packet[8:]); ts != 1500000000 {
+		t.Errorf("timestamp %d, want the one of the server", ts)
+	}
+	if s := binary.BigEndian.Uint16(packet[12:]); s != WARNING {
+		t.Errorf("return code %d, want %d", s, WARNING)
+	}
+	if h := field(packet[14 : 14+64]); h != "graylog01" {
+		t.Errorf("host %q", h)
+	}
+	if s := field(packet[78 : 78+128]); s != "Graylog" {
+		t.Errorf("service %q", s)
+	}
+	if o := field(packet[206 : 206+512]); o != "WARNING - lb_status: throttled" {
+		t.Errorf("output %q", o)
+	}
+
+	// the CRC is computed with a zeroed CRC field
+	crc := binary.BigEndian.Uint32(packet[4:])
+	zeroed := append([]byte(nil), packet...)
+	binary.BigEndian.PutUint32(zeroed[4:], 0)
+	if want := crc32.ChecksumIEEE(zeroed); crc != want {
+		t.Errorf("crc %08x, want %08x", crc, want)
+	}
+}
+
+func TestNscaPacketLimits(t *testing.T) {
+	setFlag(t, "nsca-output-length", "4096")
+
+	packet, err := nscaPacket(make([]byte, 128), 0, strings.Repeat("h", 100), OK, strings.Repeat("o", 5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet) != 4304 {
+		t.Fatalf("packet has %d bytes, want 4304", len(packet))
+	}
+	if h := field(packet[14 : 14+64]); len(h) != 63 {
+		t.Errorf("host field holds %d bytes, want 63 and a null byte", len(h))
+	}
+	if o := field(packet[206 : 206+4096]); len(o) != 4095 {
+		t.Errorf("output field holds %d bytes, want 4095 and a null byte", len(o))
+	}
+}
+
+func TestNscaPacketXor(t *testing.T) {
+	iv := make([]byte, 128)
+	for i := range iv {
+		iv[i] = byte(i)
+	}
+
+	setFlag(t, "nsca-encryption", "none")
+	plain, err := nscaPacket(iv, 42, "graylog01", CRITICAL, "CRITICAL - Service is not processing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setFlag(t, "nsca-encryption", "xor")
+	setFlag(t, "nsca-password", "secret")
+	packet, err := nscaPacket(iv, 42, "graylog01", CRITICAL, "CRITICAL - Service is not processing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("secret")
+	for i := range packet {
+		packet[i] ^= iv[i%len(iv)] ^ key[i%len(key)]
+	}
+	if !bytes.Equal(packet, plain) {
+		t.Error("xor encrypted packet does not decrypt to the plain one")
+	}
+
+	setFlag(t, "nsca-encryption", "des")
+	if _, err := nscaPacket(iv, 42, "graylog01", OK, "OK"); err == nil {
+		t.Error("unsupported encryption accepted")
+	}
+}
+
+func TestNscaSubmit(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		hello := make([]byte, 132)
+		binary.BigEndian.PutUint32(hello[128:], 1234)
+		conn.Write(hello)
+
+		packet := make([]byte, 720)
+		io.ReadFull(conn, packet)
+		received <- packet
+	}()
+
+	if err := nscaSubmit(l.Addr().String(), "graylog01", OK, "OK - Service is running!"); err != nil {
+		t.Fatal(err)
+	}
+	packet := <-received
+	if ts := binary.BigEndian.Uint32(packet[8:]); ts != 1234 {
+		t.Errorf("timestamp %d, want 1234 sent by the server", ts)
+	}
+	if o := field(packet[206:]); o != "OK - Service is running!" {
+		t.Errorf("output %q", o)
+	}
+}
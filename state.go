@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// condition overrides, keyed by <condition>_<state>
+type stateMap map[string]int
+
+// conditions reported by the checks
+var conditions = []string{
+	"api", "processing", "lifecycle", "lb_status", "collectors", "expected_collectors", "expected_nodes",
+	"leader", "time", "forwarders", "stream", "stream_alerts", "stream_routing", "stream_faults",
+}
+
+// conditions reported per instance as <condition>:<id>
+var instanceConditions = map[string]bool{"stream": true, "stream_alerts": true}
+
+// whether a -map-state condition is ever reported
+func knownCondition(name string) bool {
+	if i := strings.Index(name, ":"); i >= 0 {
+		return instanceConditions[name[:i]] && i < len(name)-1
+	}
+	for _, c := range conditions {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// flag.Value interface
+func (m stateMap) String() string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, strings.ToLower(stateName(v))))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// flag.Value interface, accepts lifecycle_warning=ok[,...]
+func (m stateMap) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expecting condition_state=state, got %q", pair)
+		}
+
+		i := strings.LastIndex(kv[0], "_")
+		if i < 1 {
+			return fmt.Errorf("expecting condition_state=state, got %q", pair)
+		}
+		if condition := strings.ToLower(kv[0][:i]); !knownCondition(condition) {
+			return fmt.Errorf("unknown condition %q, use one of: %s", condition, strings.Join(conditions, ", "))
+		}
+		from, err := parseState(kv[0][i+1:])
+		if err != nil {
+			return err
+		}
+		to, err := parseState(kv[1])
+		if err != nil {
+			return err
+		}
+
+		m[strings.ToLower(kv[0][:i+1])+strings.ToLower(stateName(from))] = to
+	}
+	return nil
+}
+
+// map nagios codes to their names
+func stateName(status int) string {
+	switch status {
+	case OK:
+		return "OK"
+	case WARNING:
+		return "WARNING"
+	case CRITICAL:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// map names to nagios codes
+func parseState(name string) (int, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "OK":
+		return OK, nil
+	case "WARNING", "WARN":
+		return WARNING, nil
+	case "CRITICAL", "CRIT":
+		return CRITICAL, nil
+	case "UNKNOWN":
+		return UNKNOWN, nil
+	}
+	return UNKNOWN, fmt.Errorf("unknown state %q", name)
+}
+
+// apply overrides to the state detected for a condition, instances like
+// stream:<id> fall back to the overrides of their condition
+func state(condition string, status int) int {
+	name := "_" + strings.ToLower(stateName(status))
+	if s, ok := stateMapping[condition+name]; ok {
+		return s
+	}
+	if i := strings.Index(condition, ":"); i > 0 {
+		if s, ok := stateMapping[condition[:i]+name]; ok {
+			return s
+		}
+	}
+	if status == WARNING && *warnAsOK {
+		return OK
+	}
+	if status == UNKNOWN && *unknownAsCritical {
+		return CRITICAL
+	}
+	return status
+}
+
+// record a sub-check result
+func report(condition string, status int, message string) {
+	results = append(results, result{name: condition, status: state(condition, status), message: message})
+}
+
+// record long output lines
+func detail(lines ...string) {
+	for _, line := range lines {
+		details = append(details, line)
+	}
+}
+
+// make text safe for plugin output lines: control characters become blanks,
+// pipes would start the performance data and invalid UTF-8 is replaced
+func sanitize(s string) string {
+	var b strings.Builder
+	blank := false
+	for _, r := range s {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			if !blank {
+				b.WriteByte(' ')
+			}
+			blank = true
+			continue
+		case r == '|':
+			b.WriteByte('/')
+		case r == utf8.RuneError:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+		blank = false
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// worst state of all sub-checks and the messages causing it
+func summary() (int, string) {
+	status := OK
+	var messages []string
+
+	for _, r := range results {
+		if r.status == OK {
+			continue
+		}
+		messages = append(messages, r.message)
+		if severity(r.status) > severity(status) {
+			status = r.status
+		}
+	}
+
+	return status, strings.Join(messages, ", ")
+}
+
+// order nagios codes by severity, unknown ranks between warning and critical
+func severity(status int) int {
+	switch status {
+	case OK:
+		return 0
+	case WARNING:
+		return 1
+	case UNKNOWN:
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStateMapSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  stateMap
+		err   string
+	}{
+		{value: "lifecycle_warning=ok", want: stateMap{"lifecycle_warning": OK}},
+		{value: "LB_Status_WARN=Critical", want: stateMap{"lb_status_warning": CRITICAL}},
+		{value: "api_critical=unknown, time_warning=ok", want: stateMap{"api_critical": UNKNOWN, "time_warning": OK}},
+		{value: "expected_collectors_crit=warn", want: stateMap{"expected_collectors_critical": WARNING}},
+		{value: "stream:5a1b2c3d_warning=ok", want: stateMap{"stream:5a1b2c3d_warning": OK}},
+		{value: "stream_alerts:5a1b2c3d_critical=warning", want: stateMap{"stream_alerts:5a1b2c3d_critical": WARNING}},
+		{value: "lbstatus_warning=ok", err: `unknown condition "lbstatus"`},
+		{value: "bogus_warning=ok", err: `unknown condition "bogus"`},
+		{value: "leader:1_warning=ok", err: `unknown condition "leader:1"`},
+		{value: "stream:_warning=ok", err: `unknown condition "stream:"`},
+		{value: "lifecycle_warning", err: "expecting condition_state=state"},
+		{value: "warning=ok", err: "expecting condition_state=state"},
+		{value: "lifecycle_fine=ok", err: `unknown state "fine"`},
+		{value: "lifecycle_warning=fine", err: `unknown state "fine"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			m := stateMap{}
+			err := m.Set(tt.value)
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m, tt.want) {
+				t.Errorf("got %v, want %v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateMapString(t *testing.T) {
+	m := stateMap{}
+	if err := m.Set("time_warning=ok,api_critical=unknown"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.String(), "api_critical=unknown,time_warning=ok"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStateInstanceFallback(t *testing.T) {
+	previous := stateMapping
+	defer func() { stateMapping = previous }()
+
+	stateMapping = stateMap{}
+	if err := stateMapping.Set("stream_warning=ok,stream:b_warning=critical"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		condition string
+		want      int
+	}{
+		{"stream:a", OK},
+		{"stream:b", CRITICAL},
+		{"stream_alerts:a", WARNING},
+	}
+	for _, tt := range tests {
+		if got := state(tt.condition, WARNING); got != tt.want {
+			t.Errorf("state(%q) = %s, want %s", tt.condition, stateName(got), stateName(tt.want))
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain text", "plain text"},
+		{"a|b=1", "a/b=1"},
+		{"line\r\nnext", "line next"},
+		{"tab\tand\x00nul", "tab and nul"},
+		{"runs\r\n\r\n\tof\n\nbreaks", "runs of breaks"},
+		{"del\x7fchar", "del char"},
+		{"trailing\r\n", "trailing"},
+		{"  leading", "  leading"},
+		{"bad \xff\xfe bytes", "bad ?? bytes"},
+		{"Größe 5 GiB – ok ✓", "Größe 5 GiB – ok ✓"},
+		{"日本語|テスト", "日本語/テスト"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitize(tt.in); got != tt.want {
+			t.Errorf("sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metric namespace of the stream router
+const streamMetric = "org.graylog2.plugin.streams.Stream."
+
+// stream given with -stream
+type streamCheck struct {
+	id string
+	// throughput thresholds, lower bounds when warn is above crit
+	warn, crit *float64
+}
+
+// repeatable -stream flag
+type streamList []streamCheck
+
+// flag.Value interface
+func (l *streamList) String() string {
+	var s []string
+	for _, c := range *l {
+		s = append(s, c.id)
+	}
+	return strings.Join(s, ",")
+}
+
+// flag.Value interface, accepts <id>[:warn:crit]
+func (l *streamList) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) != 1 && len(parts) != 3 || len(parts[0]) == 0 {
+		return fmt.Errorf("expecting <id>[:warn:crit], got %q", value)
+	}
+
+	c := streamCheck{id: parts[0]}
+	if len(parts) == 3 {
+		for i, t := range []**float64{&c.warn, &c.crit} {
+			if len(parts[i+1]) == 0 {
+				continue
+			}
+			v, err := strconv.ParseFloat(parts[i+1], 64)
+			if err != nil {
+				return fmt.Errorf("threshold %q of stream %s is not a number", parts[i+1], c.id)
+			}
+			*t = &v
+		}
+	}
+
+	*l = append(*l, c)
+	return nil
+}
+
+// whether the thresholds are minimum rates
+func (c streamCheck) lower() bool {
+	return c.warn != nil && c.crit != nil && *c.warn > *c.crit
+}
+
+// state of a throughput value
+func (c streamCheck) evaluate(v float64) int {
+	exceeds := func(t *float64) bool {
+		if t == nil {
+			return false
+		}
+		if c.lower() {
+			return v < *t
+		}
+		return v > *t
+	}
+
+	if exceeds(c.crit) {
+		return CRITICAL
+	}
+	if exceeds(c.warn) {
+		return WARNING
+	}
+	return OK
+}
+
+// performance data threshold, nagios ranges alert below start: or above end
+func (c streamCheck) threshold(t *float64) string {
+	if t == nil {
+		return ""
+	}
+	s := strconv.FormatFloat(*t, 'f', -1, 64)
+	if c.lower() {
+		return s + ":"
+	}
+	return s
+}
+
+// streams of /streams by id
+func streamIndex(c string) map[string]map[string]interface{} {
+	index := map[string]map[string]interface{}{}
+	list := query(c+"/streams", *user, *pass)
+	all, _ := list["streams"].([]interface{})
+	for _, v := range all {
+		if s, ok := v.(map[string]interface{}); ok {
+			index[fmt.Sprintf("%v", s["id"])] = s
+		}
+	}
+	return index
+}
+
+// title of a stream, the id when unknown
+func streamTitle(index map[string]map[string]interface{}, id string) string {
+	if s, ok := index[id]; ok {
+		return fmt.Sprintf("%v", s["title"])
+	}
+	return id
+}
+
+// evaluate the throughput and alerts of every -stream stream
+func checkStreams(c string) {
+	index := streamIndex(c)
+
+	for _, s := range streams {
+		condition := "stream:" + s.id
+		if _, ok := index[s.id]; !ok {
+			report(condition, UNKNOWN, fmt.Sprintf("stream %s not found", s.id))
+			continue
+		}
+		title := streamTitle(index, s.id)
+
+		tput := query(c+"/streams/"+s.id+"/throughput", *user, *pass)
+		rate, _ := tput["throughput"].(float64)
+
+		label := "stream_" + invalidLabel.ReplaceAllString(s.id, "_") + "_throughput"
+		perf(label, rate)
+		thresholds(label, s.threshold(s.warn), s.threshold(s.crit))
+		report(condition, s.evaluate(rate), fmt.Sprintf("stream %s throughput %.f", title, rate))
+
+		if *streamAlerts {
+			// legacy alert conditions are gone in Graylog 4
+			alerts, ok := optional("stream_alerts:"+s.id, c+"/streams/"+s.id+"/alerts/check")
+			if !ok {
+				continue
+			}
+			triggered, _ := alerts["total_triggered"].(float64)
+
+			perf("stream_"+invalidLabel.ReplaceAllString(s.id, "_")+"_alerts", triggered)
+			if triggered > 0 {
+				report("stream_alerts:"+s.id, CRITICAL, fmt.Sprintf("stream %s has %.f triggered alerts", title, triggered))
+			} else {
+				report("stream_alerts:"+s.id, OK, fmt.Sprintf("stream %s has no triggered alerts", title))
+			}
+		}
+	}
+}
+
+// alert on slow stream rule matching and streams paused by the fault counter
+func checkRouting(c string) {
+	index := streamIndex(c)
+
+	// one execution timer per stream, the namespace is unknown until a stream matched
+	namespace, f := fetch(c+"/system/metrics/namespace/"+strings.TrimSuffix(streamMetric, "."), *user, *pass)
+	if f != nil && f.code != 404 {
+		abort(f.status, f.message, f.err)
+	}
+	list, _ := namespace["metrics"].([]interface{})
+
+	var slowest time.Duration
+	slowestID := ""
+	for _, v := range list {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := m["full_name"].(string)
+		if !strings.HasPrefix(name, streamMetric) || !strings.HasSuffix(name, ".ExecutionTime") {
+			continue
+		}
+		timer, _ := m["metric"].(map[string]interface{})
+		times, _ := timer["time"].(map[string]interface{})
+
+		id := strings.TrimSuffix(strings.TrimPrefix(name, streamMetric), ".ExecutionTime")
+		p95, _ := times["95th_percentile"].(float64)
+		d := timerDuration(p95, timer["duration_unit"])
+		if len(slowestID) == 0 || d > slowest {
+			slowest, slowestID = d, id
+		}
+
+		for _, s := range streams {
+			if s.id == id {
+				perf("stream_"+invalidLabel.ReplaceAllString(id, "_")+"_execution_time", d.Seconds())
+			}
+		}
+	}
+
+	perf("stream_execution_time", slowest.Seconds())
+	thresholds("stream_execution_time", seconds(*streamTimeWT), seconds(*streamTimeCT))
+
+	message := "no stream has matched messages yet"
+	if len(slowestID) > 0 {
+		message = fmt.Sprintf("slowest stream %s matches in %v (95th percentile)", streamTitle(index, slowestID), slowest)
+	}
+	if *streamTimeCT > 0 && slowest >= *streamTimeCT {
+		report("stream_routing", CRITICAL, message)
+	} else if *streamTimeWT > 0 && slowest >= *streamTimeWT {
+		report("stream_routing", WARNING, message)
+	} else {
+		report("stream_routing", OK, message)
+	}
+
+	// the fault counter pauses a stream and leaves a notification
+	notifications := query(c+"/system/notifications", *user, *pass)
+	list, _ = notifications["notifications"].([]interface{})
+
+	paused := 0
+	for _, v := range list {
+		n, ok := v.(map[string]interface{})
+		if !ok || !strings.EqualFold(fmt.Sprintf("%v", n["type"]), "stream_processing_disabled") {
+			continue
+		}
+		details, _ := n["details"].(map[string]interface{})
+		id := fmt.Sprintf("%v", details["stream_id"])
+
+		// resumed or deleted since
+		if s, ok := index[id]; !ok || s["disabled"] != true {
+			continue
+		}
+
+		paused++
+		detail(fmt.Sprintf("stream %s was paused after %v faults", streamTitle(index, id), details["fault_count"]))
+	}
+
+	perf("streams_paused", float64(paused))
+	if paused > 0 {
+		report("stream_faults", CRITICAL, fmt.Sprintf("%d streams were paused by the fault counter", paused))
+	} else {
+		report("stream_faults", OK, "no stream was paused by the fault counter")
+	}
+}
+
+// a metrics timer value, milliseconds unless told otherwise
+func timerDuration(v float64, unit interface{}) time.Duration {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v)
+	case "microseconds":
+		return time.Duration(v * float64(time.Microsecond))
+	case "seconds":
+		return time.Duration(v * float64(time.Second))
+	}
+	return time.Duration(v * float64(time.Millisecond))
+}
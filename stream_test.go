@@ -0,0 +1,217 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamListSet(t *testing.T) {
+	tests := []struct {
+		value      string
+		warn, crit string
+		err        string
+	}{
+		{value: "5a1b2c3d"},
+		{value: "5a1b2c3d::"},
+		{value: "5a1b2c3d:100:200", warn: "100", crit: "200"},
+		{value: "5a1b2c3d:10:1", warn: "10:", crit: "1:"},
+		{value: "5a1b2c3d:100:", warn: "100"},
+		{value: "5a1b2c3d::0.5", crit: "0.5"},
+		{value: "5a1b2c3d:many:200", err: `threshold "many" of stream 5a1b2c3d is not a number`},
+		{value: "5a1b2c3d:100", err: "expecting <id>[:warn:crit]"},
+		{value: "5a1b2c3d:1:2:3", err: "expecting <id>[:warn:crit]"},
+		{value: ":100:200", err: "expecting <id>[:warn:crit]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			l := streamList{}
+			err := l.Set(tt.value)
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				if len(l) != 0 {
+					t.Errorf("invalid stream added: %v", l)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := l[0]
+			if c.id != "5a1b2c3d" || c.threshold(c.warn) != tt.warn || c.threshold(c.crit) != tt.crit {
+				t.Errorf("got %s warn %q crit %q, want warn %q crit %q", c.id, c.threshold(c.warn), c.threshold(c.crit), tt.warn, tt.crit)
+			}
+		})
+	}
+}
+
+func TestStreamListString(t *testing.T) {
+	l := streamList{}
+	for _, v := range []string{"a:1:2", "b"} {
+		if err := l.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := l.String(); got != "a,b" {
+		t.Errorf("got %q, want a,b", got)
+	}
+}
+
+func TestStreamEvaluate(t *testing.T) {
+	tests := []struct {
+		value string
+		rate  float64
+		want  int
+	}{
+		{"s", 1e6, OK},
+		{"s::", 1e6, OK},
+		{"s:100:200", 50, OK},
+		{"s:100:200", 100, OK},
+		{"s:100:200", 150, WARNING},
+		{"s:100:200", 250, CRITICAL},
+		{"s:10:1", 20, OK},
+		{"s:10:1", 10, OK},
+		{"s:10:1", 5, WARNING},
+		{"s:10:1", 0, CRITICAL},
+		{"s:100:", 150, WARNING},
+		{"s::200", 150, OK},
+		{"s::200", 250, CRITICAL},
+	}
+
+	for _, tt := range tests {
+		l := streamList{}
+		if err := l.Set(tt.value); err != nil {
+			t.Fatal(err)
+		}
+		if got := l[0].evaluate(tt.rate); got != tt.want {
+			t.Errorf("%s at %v = %s, want %s", tt.value, tt.rate, stateName(got), stateName(tt.want))
+		}
+	}
+}
+
+func TestCheckStreamsLowerBounds(t *testing.T) {
+	previous := streams
+	t.Cleanup(func() { streams = previous })
+	streams = streamList{}
+	for _, v := range []string{"5a1b2c3d:10:1", "missing"} {
+		if err := streams.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := graylogFixture(t, map[string]string{
+		"/streams":                     `{"streams": [{"id": "5a1b2c3d", "title": "Firewall"}]}`,
+		"/streams/5a1b2c3d/throughput": `{"throughput": 5}`,
+	})
+
+	reset()
+	checkStreams(ts.URL)
+
+	if r, _ := resultOf("stream:5a1b2c3d"); r.status != WARNING || r.message != "stream Firewall throughput 5" {
+		t.Errorf("stream result %+v", r)
+	}
+	if r, _ := resultOf("stream:missing"); r.status != UNKNOWN || r.message != "stream missing not found" {
+		t.Errorf("missing stream result %+v", r)
+	}
+	if !strings.Contains(pdata(), "stream_5a1b2c3d_throughput=5;10:;1:;;") {
+		t.Errorf("no lower bound ranges in %q", pdata())
+	}
+}
+
+func TestTimerDuration(t *testing.T) {
+	tests := []struct {
+		value float64
+		unit  interface{}
+		want  time.Duration
+	}{
+		{1500, "nanoseconds", 1500 * time.Nanosecond},
+		{120, "microseconds", 120 * time.Microsecond},
+		{2.5, "milliseconds", 2500 * time.Microsecond},
+		{0.25, "seconds", 250 * time.Millisecond},
+		{3, nil, 3 * time.Millisecond},
+		{3, "fortnights", 3 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := timerDuration(tt.value, tt.unit); got != tt.want {
+			t.Errorf("timerDuration(%v, %v) = %v, want %v", tt.value, tt.unit, got, tt.want)
+		}
+	}
+}
+
+// stream router timer of the metrics namespace reply
+func routerTimer(id string, p95 float64) string {
+	return `{"full_name": "org.graylog2.plugin.streams.Stream.` + id + `.ExecutionTime", "type": "timer",
+		"metric": {"time": {"95th_percentile": ` + strconv.FormatFloat(p95, 'f', -1, 64) + `}, "duration_unit": "microseconds"}}`
+}
+
+func TestCheckRouting(t *testing.T) {
+	previous := streams
+	t.Cleanup(func() { streams = previous })
+	streams = streamList{{id: "b"}}
+	setFlag(t, "stream-time-warn", "5ms")
+	setFlag(t, "stream-time-crit", "50ms")
+
+	ts := graylogFixture(t, map[string]string{
+		"/streams": `{"streams": [
+			{"id": "a", "title": "Firewall", "disabled": true},
+			{"id": "b", "title": "Web", "disabled": false},
+			{"id": "c", "title": "Mail", "disabled": true}
+		]}`,
+		"/system/metrics/namespace/org.graylog2.plugin.streams.Stream": `{"total": 4, "metrics": [
+			` + routerTimer("a", 7000) + `,
+			` + routerTimer("b", 120) + `,
+			{"full_name": "org.graylog2.plugin.streams.Stream.a.incomingMessages", "type": "meter", "metric": {"rate": {"total": 5}}},
+			{"full_name": "org.graylog2.plugin.streams.StreamRouterEngine.x.ExecutionTime", "type": "timer",
+				"metric": {"time": {"95th_percentile": 900000}, "duration_unit": "microseconds"}}
+		]}`,
+		"/system/notifications": `{"notifications": [
+			{"type": "stream_processing_disabled", "details": {"stream_id": "a", "stream_title": "Firewall", "fault_count": 3}},
+			{"type": "STREAM_PROCESSING_DISABLED", "details": {"stream_id": "b", "fault_count": 3}},
+			{"type": "stream_processing_disabled", "details": {"stream_id": "deleted", "fault_count": 3}},
+			{"type": "no_master", "details": {"stream_id": "c"}}
+		]}`,
+	})
+
+	reset()
+	checkRouting(ts.URL)
+
+	if r, _ := resultOf("stream_routing"); r.status != WARNING || r.message != "slowest stream Firewall matches in 7ms (95th percentile)" {
+		t.Errorf("routing result %+v", r)
+	}
+	if r, _ := resultOf("stream_faults"); r.status != CRITICAL || r.message != "1 streams were paused by the fault counter" {
+		t.Errorf("faults result %+v", r)
+	}
+	if !reflect.DeepEqual(details, []string{"stream Firewall was paused after 3 faults"}) {
+		t.Errorf("details %q, want only the stream still paused", details)
+	}
+	for _, want := range []string{"stream_execution_time=0.007;0.005;0.05;;", "stream_b_execution_time=0.00012;;;;", "streams_paused=1;;;;"} {
+		if !strings.Contains(pdata(), want) {
+			t.Errorf("missing %q in %q", want, pdata())
+		}
+	}
+	if strings.Contains(pdata(), "stream_a_execution_time") {
+		t.Errorf("execution time of a stream without -stream in %q", pdata())
+	}
+}
+
+func TestCheckRoutingNoMetricsYet(t *testing.T) {
+	ts := graylogFixture(t, map[string]string{
+		"/streams":              `{"streams": []}`,
+		"/system/notifications": `{"notifications": []}`,
+	})
+
+	reset()
+	checkRouting(ts.URL)
+
+	if r, _ := resultOf("stream_routing"); r.status != OK || r.message != "no stream has matched messages yet" {
+		t.Errorf("routing result %+v", r)
+	}
+	if r, _ := resultOf("stream_faults"); r.status != OK {
+		t.Errorf("faults result %+v", r)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// result submitters, each one does nothing unless its flags are set
+var submitters = []func(status int, message string) error{
+	zabbixSubmit,
+	passiveSubmit,
+	icinga2Submit,
+}
+
+// push the result to every configured receiver
+func submit(status int, message string) {
+	for _, send := range submitters {
+		if err := send(status, message); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Graylog cluster of a -targets-file
+type target struct {
+	name string
+	urls []string
+	// flag values of this cluster
+	options map[string]string
+}
+
+// clusters checked in batch mode
+var targets []target
+
+// unprefixed results of a cluster in the last batch
+type clusterRun struct {
+	name    string
+	status  int
+	results []result
+	metrics []metric
+}
+
+// clusters of the last batch, for outputs tagging by cluster
+var clusterRuns []clusterRun
+
+// flags of the whole invocation, not settable per cluster
+var processFlags = map[string]bool{
+	"l": true, "map-state": true, "version": true, "extra-opts": true, "targets-file": true,
+	"output": true, "max-output-bytes": true, "textfile-dir": true, "textfile-name": true,
+	"daemon": true, "listen": true, "interval": true,
+	"submit": true, "submit-host": true, "submit-service": true, "nsca-password": true,
+	"nsca-encryption": true, "nsca-output-length": true, "nrdp-token": true,
+	"icinga2-url": true, "icinga2-user": true, "icinga2-password": true, "icinga2-service": true,
+	"zabbix-host": true, "zabbix-server": true,
+}
+
+// friendly names of the connection flags
+var targetAliases = map[string]string{
+	"user":     "u",
+	"password": "p",
+}
+
+// characters not allowed in performance data labels
+var invalidLabel = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// read a targets file, a YAML list of mappings with scalar values:
+//
+//	clusters:
+//	  - name: customer-a
+//	    url: https://graylog-a:9000/api
+//	    user: monitoring
+//	    password: "secret"
+//	    ct: 5
+func loadTargets(file string) ([]target, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []target
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(yamlComment(scanner.Text()))
+		if line == "" || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			list = append(list, target{options: map[string]string{}})
+			line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+			if line == "" {
+				continue
+			}
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%s:%d: expecting key: value", file, n)
+		}
+		key, value := strings.TrimSpace(kv[0]), unquote(strings.TrimSpace(kv[1]))
+		if len(list) == 0 {
+			// wrapping key like clusters:
+			if value == "" {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: expecting a list of clusters", file, n)
+		}
+
+		t := &list[len(list)-1]
+		switch key {
+		case "name":
+			t.name = value
+		case "url", "l":
+			for _, u := range strings.Split(value, ",") {
+				// parsed once the options of the cluster, like cloud, are set
+				if u = strings.TrimSpace(u); len(u) > 0 {
+					t.urls = append(t.urls, u)
+				}
+			}
+		default:
+			if alias, ok := targetAliases[key]; ok {
+				key = alias
+			}
+			f := flag.Lookup(key)
+			if f == nil || processFlags[key] {
+				return nil, fmt.Errorf("%s:%d: %s can not be set per cluster", file, n, key)
+			}
+			if _, ok := f.Value.(flag.Getter); !ok {
+				return nil, fmt.Errorf("%s:%d: %s can not be set per cluster", file, n, key)
+			}
+			t.options[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		if list[i].name == "" && len(list[i].urls) > 0 {
+			list[i].name = list[i].urls[0]
+		}
+		if list[i].name == "" {
+			return nil, fmt.Errorf("%s: cluster %d has neither name nor url", file, i+1)
+		}
+	}
+
+	return list, nil
+}
+
+// strip a YAML comment outside of quotes
+func yamlComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// set the flags of a cluster, returning a function restoring the previous values
+func (t target) apply() (func(), error) {
+	previous := map[string]string{}
+	restore := func() {
+		for k, v := range previous {
+			flag.Set(k, v)
+		}
+	}
+
+	for k, v := range t.options {
+		previous[k] = flag.Lookup(k).Value.String()
+		if err := flag.Set(k, v); err != nil {
+			restore()
+			return nil, fmt.Errorf("%s: invalid value %q for %s: %v", t.name, v, k, err)
+		}
+	}
+	return restore, nil
+}
+
+// run the checks of a single cluster or all clusters of -targets-file
+func check(static []string) outcome {
+	if len(targets) == 0 {
+		return failover(static)
+	}
+	return batch(static)
+}
+
+// check every cluster, aggregating their results under the cluster name
+func batch(static []string) outcome {
+	var (
+		all     []result
+		perf    []metric
+		long    []string
+		summary []string
+		done    bool
+		runs    []clusterRun
+	)
+	status := OK
+
+	for _, t := range targets {
+		prefix := invalidLabel.ReplaceAllString(t.name, "_") + "_"
+
+		restore, err := t.apply()
+		if err != nil {
+			reset()
+			return outcome{status: UNKNOWN, message: err.Error(), err: err}
+		}
+		links := t.urls
+		if len(links) == 0 {
+			links = static
+		}
+		var urls []string
+		for _, link := range links {
+			u, err := parseURL(link)
+			if err != nil {
+				restore()
+				reset()
+				return outcome{status: UNKNOWN, message: fmt.Sprintf("%s: %s %v", t.name, link, err), err: err}
+			}
+			urls = append(urls, u)
+		}
+		o := failover(urls)
+		restore()
+
+		run := clusterRun{name: t.name, status: o.status, results: results}
+		if completed {
+			run.metrics = metrics
+		}
+		runs = append(runs, run)
+
+		// per cluster notes, keeping the summary lines within the long output
+		long = append(long, fmt.Sprintf("[%s] %s", t.name, summaryText(o.status, o.message)))
+		if o.status != OK {
+			summary = append(summary, fmt.Sprintf("%s %s", t.name, stateName(o.status)))
+			for _, d := range details {
+				long = append(long, "  "+d)
+			}
+		}
+		for _, r := range results {
+			all = append(all, result{name: prefix + r.name, status: r.status, message: r.message})
+		}
+		// a failed cluster leaves gaps instead of zeros
+		if completed {
+			done = true
+			for _, m := range metrics {
+				m.label = prefix + m.label
+				perf = append(perf, m)
+			}
+		}
+
+		if severity(o.status) > severity(status) {
+			status = o.status
+		}
+	}
+
+	reset()
+	results, metrics, details, completed = all, perf, long, done
+	clusterRuns = runs
+
+	if status == OK {
+		return outcome{status: OK, message: fmt.Sprintf("All %d clusters are OK", len(targets))}
+	}
+	return outcome{status: status, message: fmt.Sprintf("%d of %d clusters are not OK: %s", len(summary), len(targets), strings.Join(summary, ", "))}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// write a targets file to a temporary directory
+func targetsFixture(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "targets.yml")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []target
+		err     string
+	}{
+		{
+			name: "wrapping key",
+			content: `clusters:
+  - name: a
+    url: http://a:9000/api
+`,
+			want: []target{{name: "a", urls: []string{"http://a:9000/api"}, options: map[string]string{}}},
+		},
+		{
+			name: "bare list",
+			content: `---
+- name: a
+  url: http://a:9000/api, http://b:9000/api
+-
+  name: c
+  url: http://c:9000/api
+`,
+			want: []target{
+				{name: "a", urls: []string{"http://a:9000/api", "http://b:9000/api"}, options: map[string]string{}},
+				{name: "c", urls: []string{"http://c:9000/api"}, options: map[string]string{}},
+			},
+		},
+		{
+			name: "quoting",
+			content: `- name: 'customer a'
+  password: "se#cret"
+  user: "it's me"
+`,
+			want: []target{{name: "customer a", options: map[string]string{"p": "se#cret", "u": "it's me"}}},
+		},
+		{
+			name: "comments",
+			content: `# all clusters
+- name: a # the first
+  url: http://a:9000/api#fragment
+  ct: 5	# tabs too
+`,
+			want: []target{{name: "a", urls: []string{"http://a:9000/api#fragment"}, options: map[string]string{"ct": "5"}}},
+		},
+		{
+			name:    "name defaults to url",
+			content: "- url: http://a:9000/api\n",
+			want:    []target{{name: "http://a:9000/api", urls: []string{"http://a:9000/api"}, options: map[string]string{}}},
+		},
+		{
+			name: "cloud url parsed later",
+			content: `- name: tenant
+  url: https://tenant.graylog.cloud
+  cloud: true
+`,
+			want: []target{{name: "tenant", urls: []string{"https://tenant.graylog.cloud"}, options: map[string]string{"cloud": "true"}}},
+		},
+		{name: "unknown key", content: "- name: a\n  bogus: 1\n", err: "targets.yml:2: bogus can not be set per cluster"},
+		{name: "process key", content: "- name: a\n  output: json\n", err: "targets.yml:2: output can not be set per cluster"},
+		{name: "no list", content: "name: a\n", err: "targets.yml:1: expecting a list of clusters"},
+		{name: "no key", content: "- name: a\n  just text\n", err: "targets.yml:2: expecting key: value"},
+		{name: "no name or url", content: "- ct: 5\n", err: "cluster 1 has neither name nor url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadTargets(targetsFixture(t, tt.content))
+			if len(tt.err) > 0 {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYamlComment(t *testing.T) {
+	tests := map[string]string{
+		"key: value # note":    "key: value ",
+		"# whole line":         "",
+		"key: a#b":             "key: a#b",
+		`key: "a # b" # note`:  `key: "a # b" `,
+		`key: 'a # b'`:         `key: 'a # b'`,
+		"key: value\t# tabbed": "key: value\t",
+	}
+	for line, want := range tests {
+		if got := yamlComment(line); got != want {
+			t.Errorf("yamlComment(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestTargetApply(t *testing.T) {
+	ct, wt := *collectorCT, *collectorWT
+	tt := target{name: "a", options: map[string]string{"ct": "7", "wt": "3"}}
+
+	restore, err := tt.apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *collectorCT != 7 || *collectorWT != 3 {
+		t.Errorf("applied ct=%d wt=%d, want 7 and 3", *collectorCT, *collectorWT)
+	}
+
+	restore()
+	if *collectorCT != ct || *collectorWT != wt {
+		t.Errorf("restored ct=%d wt=%d, want %d and %d", *collectorCT, *collectorWT, ct, wt)
+	}
+}
+
+func TestTargetApplyInvalid(t *testing.T) {
+	wt := *collectorWT
+	tt := target{name: "a", options: map[string]string{"wt": "3", "ct": "many"}}
+
+	if _, err := tt.apply(); err == nil || !strings.Contains(err.Error(), `invalid value "many" for ct`) {
+		t.Fatalf("error = %v, want invalid value", err)
+	}
+	if *collectorWT != wt {
+		t.Errorf("wt=%d after failed apply, want %d", *collectorWT, wt)
+	}
+}
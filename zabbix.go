@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// zabbix trapper item
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+// all results as zabbix items
+func zabbixItems(host string, status int, message string) []zabbixItem {
+	clock := time.Now().Unix()
+	items := []zabbixItem{
+		{host, "graylog.status", strconv.Itoa(status), clock},
+		{host, "graylog.message", message, clock},
+	}
+
+	for _, r := range results {
+		items = append(items, zabbixItem{host, fmt.Sprintf("graylog.check[%s]", r.name), strconv.Itoa(r.status), clock})
+	}
+	for _, m := range metrics {
+		items = append(items, zabbixItem{host, "graylog." + m.label, strconv.FormatFloat(m.value, 'f', -1, 64), clock})
+	}
+
+	return items
+}
+
+// zabbix_sender input file format, usable with zabbix_sender -T -i
+func zabbixOutput(status int, message string, err error) {
+	host := *zabbixHost
+	if host == "" {
+		// zabbix_sender substitutes the Hostname of its configuration
+		host = "-"
+	}
+
+	for _, item := range zabbixItems(host, status, message) {
+		fmt.Printf("%s %s %d %s\n", zabbixQuote(item.Host), item.Key, item.Clock, zabbixQuote(item.Value))
+	}
+}
+
+// quote zabbix_sender fields containing blanks or quotes, each item has to
+// stay on one line so control characters become a blank
+func zabbixQuote(s string) string {
+	s = strings.Join(strings.FieldsFunc(s, unicode.IsControl), " ")
+	if s != "" && !strings.ContainsAny(s, " \t\"\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// send the items via the zabbix trapper protocol
+func zabbixSubmit(status int, message string) error {
+	if *zabbixServer == "" {
+		return nil
+	}
+
+	host := thisHost(*zabbixHost)
+
+	data, err := json.Marshal(struct {
+		Request string       `json:"request"`
+		Data    []zabbixItem `json:"data"`
+		Clock   int64        `json:"clock"`
+	}{"sender data", zabbixItems(host, status, message), time.Now().Unix()})
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", *zabbixServer, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("Can not connect to Zabbix trapper: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// ZBXD, protocol flags, data length and reserved bytes
+	var packet bytes.Buffer
+	packet.WriteString("ZBXD\x01")
+	binary.Write(&packet, binary.LittleEndian, uint32(len(data)))
+	binary.Write(&packet, binary.LittleEndian, uint32(0))
+	packet.Write(data)
+
+	if _, err := conn.Write(packet.Bytes()); err != nil {
+		return fmt.Errorf("Can not send to Zabbix trapper: %v", err)
+	}
+
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(conn, header); err != nil || string(header[:4]) != "ZBXD" {
+		return fmt.Errorf("No response received from Zabbix trapper: %v", err)
+	}
+	body, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return fmt.Errorf("No response received from Zabbix trapper: %v", err)
+	}
+
+	var reply struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return fmt.Errorf("Can not parse Zabbix trapper response: %v", err)
+	}
+	if reply.Response != "success" {
+		return fmt.Errorf("Zabbix trapper replied %s: %s", reply.Response, reply.Info)
+	}
+	if len(debug) != 0 {
+		fmt.Fprintln(os.Stderr, reply.Info)
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestZabbixQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"42", "42"},
+		{"", `""`},
+		{"a|b", "a|b"},
+		{"two words", `"two words"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\path`, `"C:\\path"`},
+		{"first\nsecond", `"first second"`},
+		{"runs\r\n\r\nof breaks\n", `"runs of breaks"`},
+		{"del\x7f", "del"},
+	}
+
+	for _, tt := range tests {
+		if got := zabbixQuote(tt.in); got != tt.want {
+			t.Errorf("zabbixQuote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}